@@ -0,0 +1,145 @@
+package ctrl
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"time"
+)
+
+// AdminOption represents a functional option for AdminServer.
+type AdminOption func(*Admin)
+
+// WithAdminAllowRemote lets clients other than loopback ones reach the admin server.
+func WithAdminAllowRemote() AdminOption {
+	return func(a *Admin) {
+		a.allowRemote = true
+	}
+}
+
+// Admin is the admin and debug server built by AdminServer.
+type Admin struct {
+	Server *http.Server   // the server, with timeouts fit for profiles taking a while
+	Mux    *http.ServeMux // the endpoints, more can be added before Run
+
+	allowRemote bool
+}
+
+// AdminServer builds the admin and debug server every service sets up otherwise, listening on addr,
+// "localhost:6060" if empty, with:
+//
+//   - /debug/pprof/ with the net/http/pprof profiles
+//   - /debug/vars with the expvar variables
+//   - /debug/buildinfo with the build information of the binary
+//   - /status with the process status as reported by the control socket status command
+//   - /health answering 200 while the process serves and 503 once it started draining
+//
+// Requests not coming from a loopback address are refused unless WithAdminAllowRemote is set.
+func AdminServer(addr string, opts ...AdminOption) *Admin {
+	if addr == "" {
+		addr = "localhost:6060"
+	}
+	a := &Admin{Mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	a.Mux.HandleFunc("/debug/pprof/", pprof.Index)
+	a.Mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	a.Mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	a.Mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	a.Mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	a.Mux.Handle("/debug/vars", expvar.Handler())
+	a.Mux.HandleFunc("/debug/buildinfo", buildInfo)
+	a.Mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(processStatus(r.Context()))
+	})
+	a.Mux.HandleFunc("/health", health)
+
+	a.Server = &http.Server{
+		Addr:              addr,
+		Handler:           http.HandlerFunc(a.serveHTTP),
+		ReadHeaderTimeout: 5 * time.Second,
+		// profiles and traces stream for as long as asked, 30 seconds by default
+		WriteTimeout: 5 * time.Minute,
+		IdleTimeout:  time.Minute,
+	}
+	return a
+}
+
+// Run runs the admin server with the semantics of RunHTTPServerWithContext, except that with a context
+// from GracefulShutdown given a lifecycle with WithLifecycle it keeps serving through the drain and stops
+// only once the lifecycle enters StateStopped or StateForceExiting, so the diagnostics stay available
+// while the other servers drain. The caller reports the other servers stopped with
+// Lifecycle.Transition(StateStopped), then waits for the admin server. Otherwise it stops when the
+// context is canceled, as no one could report the other servers stopped.
+func (a *Admin) Run(ctx context.Context, opts ...HTTPOption) <-chan error {
+	runCtx := ctx
+	if c := controlFrom(ctx); c != nil && c.callerLifecycle {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+		context.AfterFunc(c.lifecycle.Context(StateStopped), cancel)
+	}
+
+	// the handlers see the values of the context, the status of the shutdown among them
+	withValues := func(server *http.Server) (restore func()) {
+		prev := server.BaseContext
+		server.BaseContext = func(net.Listener) context.Context { return context.WithoutCancel(ctx) }
+		return func() { server.BaseContext = prev }
+	}
+	opts = append(opts[:len(opts):len(opts)], withHTTPHook(withValues))
+	return RunHTTPServerWithContext(runCtx, a.Server, a.Server.ListenAndServe, opts...)
+}
+
+// serveHTTP refuses remote clients unless allowed.
+func (a *Admin) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.allowRemote && !isLoopback(r.RemoteAddr) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	a.Mux.ServeHTTP(w, r)
+}
+
+// isLoopback reports whether the remote address of a request is a loopback one.
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// buildInfo writes the build information of the binary.
+func buildInfo(w http.ResponseWriter, _ *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "no build information", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(info.String()))
+}
+
+// health answers 200 while the process serves, 503 before the caller reported it ready and once it
+// started draining. Without a lifecycle of the caller's, no one reports the process ready, so it
+// serves from the start.
+func health(w http.ResponseWriter, r *http.Request) {
+	state := StateReady
+	if c := controlFrom(r.Context()); c != nil {
+		state = c.lifecycle.State()
+		if state == StateStarting && !c.callerLifecycle {
+			state = StateReady
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if state != StateReady {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write([]byte(state.String()))
+}
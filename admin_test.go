@@ -0,0 +1,135 @@
+package ctrl
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminServer(t *testing.T) {
+	t.Run("endpoints for loopback clients only", func(t *testing.T) {
+		a := AdminServer("")
+		assert.Equal(t, "localhost:6060", a.Server.Addr)
+
+		get := func(path, remote string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, http.NoBody)
+			req.RemoteAddr = remote
+			rec := httptest.NewRecorder()
+			a.Server.Handler.ServeHTTP(rec, req)
+			return rec
+		}
+		for _, path := range []string{"/debug/pprof/", "/debug/vars", "/debug/buildinfo", "/status", "/health"} {
+			assert.Equal(t, http.StatusOK, get(path, "127.0.0.1:1234").Code, path)
+			assert.Equal(t, http.StatusOK, get(path, "[::1]:1234").Code, path)
+			assert.Equal(t, http.StatusForbidden, get(path, "192.0.2.1:1234").Code, path)
+		}
+		assert.Contains(t, get("/debug/vars", "127.0.0.1:1").Body.String(), "memstats")
+		assert.Contains(t, get("/debug/buildinfo", "127.0.0.1:1").Body.String(), "go\t")
+
+		remote := AdminServer("", WithAdminAllowRemote())
+		req := httptest.NewRequest(http.MethodGet, "/health", http.NoBody)
+		rec := httptest.NewRecorder()
+		remote.Server.Handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("stops with the context without a lifecycle", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		ctx, cancel := GracefulShutdown(WithLogger(logger), WithoutForceExit())
+		defer cancel()
+
+		a := AdminServer(freeAddr(t))
+		errCh := a.Run(ctx, WithHTTPLogger(logger))
+		client := &http.Client{Timeout: waitLimit}
+		require.Eventually(t, func() bool {
+			resp, err := client.Get("http://" + a.Server.Addr + "/health")
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK
+		}, waitLimit, 10*time.Millisecond, "healthy without a lifecycle to report ready")
+
+		cancel()
+		select {
+		case err := <-errCh:
+			require.NoError(t, err)
+		case <-time.After(waitLimit):
+			t.Fatal("admin server did not stop")
+		}
+	})
+
+	t.Run("serves through the drain and stops last", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lc := NewLifecycle()
+		ctx, cancel := GracefulShutdown(WithLifecycle(lc), WithLogger(logger), WithoutForceExit())
+		defer cancel()
+
+		a := AdminServer(freeAddr(t))
+		errCh := a.Run(ctx, WithHTTPLogger(logger))
+		client := &http.Client{Timeout: waitLimit}
+		get := func(path string) (int, string) {
+			resp, err := client.Get("http://" + a.Server.Addr + path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			return resp.StatusCode, string(body)
+		}
+		require.Eventually(t, func() bool {
+			resp, err := client.Get("http://" + a.Server.Addr + "/health")
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return true
+		}, waitLimit, 10*time.Millisecond)
+
+		code, body := get("/health")
+		assert.Equal(t, http.StatusServiceUnavailable, code, "not ready while starting")
+		assert.Equal(t, "starting", body)
+		require.NoError(t, lc.Transition(StateReady))
+		code, body = get("/health")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ready", body)
+
+		_, body = get("/status")
+		var st ControlStatus
+		require.NoError(t, json.Unmarshal([]byte(body), &st))
+		assert.Equal(t, "ready", st.State)
+
+		cancel()
+		code, body = get("/health")
+		assert.Equal(t, http.StatusServiceUnavailable, code, "serving while stopping")
+		assert.Equal(t, "stopping", body)
+		select {
+		case <-errCh:
+			t.Fatal("stopped before the process")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		require.NoError(t, lc.Transition(StateStopped))
+		select {
+		case err := <-errCh:
+			require.NoError(t, err)
+		case <-time.After(waitLimit):
+			t.Fatal("not stopped with the process")
+		}
+	})
+
+	t.Run("stops with a plain context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		a := AdminServer(freeAddr(t))
+		errCh := a.Run(ctx, WithHTTPLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+}
@@ -0,0 +1,102 @@
+// Command ctrlctl drives a process serving the ctrl control socket, see ctrl.RunControlSocket.
+//
+// Usage:
+//
+//	ctrlctl [-socket path] [-timeout duration] command [args...]
+//
+// Commands are status, shutdown, reload, goroutines and log-level [level]. The socket path defaults
+// to the CTRL_SOCKET environment variable.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/go-pkgz/ctrl"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "ctrlctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the arguments, sends the command and prints the result.
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("ctrlctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	socket := fs.String("socket", os.Getenv("CTRL_SOCKET"), "path of the control socket")
+	timeout := fs.Duration("timeout", 10*time.Second, "time to wait for the answer")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ctrlctl [-socket path] [-timeout duration] command [args...]")
+		fmt.Fprintln(stderr, "commands: status, shutdown, reload, goroutines, log-level [level]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no command given")
+	}
+	if *socket == "" {
+		return errors.New("no socket given, set -socket or CTRL_SOCKET")
+	}
+
+	resp, err := send(*socket, *timeout, ctrl.ControlRequest{Command: fs.Arg(0), Args: fs.Args()[1:]})
+	if err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("%s failed: %s", fs.Arg(0), resp.Error)
+	}
+	return printResult(stdout, resp.Result)
+}
+
+// send writes the request to the socket and reads the answer.
+func send(socket string, timeout time.Duration, req ctrl.ControlRequest) (ctrl.ControlResponse, error) {
+	conn, err := net.DialTimeout("unix", socket, timeout)
+	if err != nil {
+		return ctrl.ControlResponse{}, fmt.Errorf("connect to %s: %w", socket, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return ctrl.ControlResponse{}, fmt.Errorf("send request: %w", err)
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return ctrl.ControlResponse{}, fmt.Errorf("read response: %w", err)
+	}
+	var resp ctrl.ControlResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return ctrl.ControlResponse{}, fmt.Errorf("decode response: %w", err)
+	}
+	return resp, nil
+}
+
+// printResult prints a string result as is and any other result as indented JSON.
+func printResult(w io.Writer, result json.RawMessage) error {
+	var s string
+	if err := json.Unmarshal(result, &s); err == nil {
+		_, err = fmt.Fprintln(w, s)
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, result, "", "  "); err != nil {
+		return fmt.Errorf("format result: %w", err)
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w)
+	return err
+}
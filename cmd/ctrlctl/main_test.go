@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/ctrl"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ctrlctl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ctrl.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	level := &slog.LevelVar{}
+	errCh := ctrl.RunControlSocket(ctx, path, ctrl.WithControlLogLevel(level),
+		ctrl.WithControlLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, run([]string{"-socket", path, "status"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), `"pid": `)
+
+	stdout.Reset()
+	t.Setenv("CTRL_SOCKET", path)
+	require.NoError(t, run([]string{"log-level", "warn"}, &stdout, &stderr))
+	assert.Equal(t, "WARN\n", stdout.String())
+	assert.Equal(t, slog.LevelWarn, level.Level())
+
+	err = run([]string{"reload"}, &stdout, &stderr)
+	require.EqualError(t, err, "reload failed: reload is not configured")
+
+	err = run(nil, &stdout, &stderr)
+	require.EqualError(t, err, "no command given")
+	assert.Contains(t, stderr.String(), "usage: ctrlctl")
+
+	err = run([]string{"-socket", filepath.Join(dir, "missing.sock"), "status"}, &stdout, &stderr)
+	require.Error(t, err)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
@@ -0,0 +1,294 @@
+package ctrl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrControlShutdown is the shutdown cause recorded when the shutdown was requested over the control socket.
+var ErrControlShutdown = errors.New("shutdown requested over the control socket")
+
+// ControlRequest is a request sent to the control socket, one JSON object per line.
+type ControlRequest struct {
+	Command string   `json:"command"`        // status, shutdown, reload, goroutines or log-level
+	Args    []string `json:"args,omitempty"` // the level for log-level, none for the other commands
+}
+
+// ControlResponse is the answer to a ControlRequest, one JSON object per line.
+type ControlResponse struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// ControlStatus is the result of the status command.
+type ControlStatus struct {
+	PID        int            `json:"pid"`
+	State      string         `json:"state,omitempty"`  // lifecycle state, if the context comes from GracefulShutdown
+	Uptime     string         `json:"uptime,omitempty"` // since GracefulShutdown was called
+	Goroutines int            `json:"goroutines"`
+	Servers    []ServerStatus `json:"servers"`
+}
+
+// ControlOption represents a functional option for the control socket.
+type ControlOption func(*controlOptions)
+
+type controlOptions struct {
+	logger   *slog.Logger
+	mode     fs.FileMode
+	reload   func() error
+	logLevel *slog.LevelVar
+}
+
+// WithControlLogger sets a custom logger for the control socket.
+func WithControlLogger(logger *slog.Logger) ControlOption {
+	return func(o *controlOptions) {
+		o.logger = logger
+	}
+}
+
+// WithControlSocketMode sets the permissions of the socket file, 0600 by default.
+func WithControlSocketMode(mode fs.FileMode) ControlOption {
+	return func(o *controlOptions) {
+		o.mode = mode
+	}
+}
+
+// WithControlReload sets the function run by the reload command, its error is returned to the client.
+func WithControlReload(fn func() error) ControlOption {
+	return func(o *controlOptions) {
+		o.reload = fn
+	}
+}
+
+// WithControlLogLevel sets the level changed by the log-level command.
+func WithControlLogLevel(level *slog.LevelVar) ControlOption {
+	return func(o *controlOptions) {
+		o.logLevel = level
+	}
+}
+
+// RunControlSocket serves the control protocol on a unix domain socket at the given path until the
+// context is canceled, letting operators drive the process with the ctrlctl command instead of raw
+// signals. Each line sent to the socket is a ControlRequest answered by a ControlResponse; the shutdown
+// command triggers the graceful shutdown the context comes from with ErrControlShutdown as the cause.
+//
+// Like RunHTTPServerWithContext it returns a channel publishing the result once the socket stopped,
+// after the open connections were closed and the socket file removed. A socket file left by a previous
+// run is replaced.
+func RunControlSocket(ctx context.Context, path string, opts ...ControlOption) <-chan error {
+	options := controlOptions{
+		logger: slog.Default(),
+		mode:   0o600,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	errCh := make(chan error, 1)
+
+	listener, err := listenControl(path, options.mode, options.logger)
+	if err != nil {
+		errCh <- err
+		close(errCh)
+		return errCh
+	}
+
+	s := &controlServer{ctx: ctx, options: options, conns: map[net.Conn]struct{}{}}
+	go func() {
+		defer close(errCh)
+		errCh <- s.serve(listener, path)
+	}()
+	return errCh
+}
+
+// listenControl listens on the socket path, replacing a socket file left by a previous run that is
+// gone. A socket another process still listens on is not taken over. The socket gets the mode before
+// anyone else can connect.
+func listenControl(path string, mode fs.FileMode, logger *slog.Logger) (net.Listener, error) {
+	if err := removeStaleSocket(path, logger); err != nil {
+		return nil, fmt.Errorf("listen on control socket: %w", err)
+	}
+	listener, err := listenSocket(path, mode)
+	if err != nil {
+		return nil, fmt.Errorf("listen on control socket: %w", err)
+	}
+	return listener, nil
+}
+
+// controlServer serves the control protocol.
+type controlServer struct {
+	ctx     context.Context
+	options controlOptions
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// serve accepts connections until the context ends or accepting fails, then closes the open ones.
+func (s *controlServer) serve(listener net.Listener, path string) error {
+	unregister := registerServer(s.ctx, "control", path)
+	defer unregister()
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-s.ctx.Done():
+		case <-stopped:
+		}
+		listener.Close()
+	}()
+
+	var acceptErr error
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.ctx.Err() == nil {
+				acceptErr = fmt.Errorf("accept on control socket: %w", err)
+			}
+			break
+		}
+		s.track(conn, true)
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+	close(stopped)
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	// the listener unlinks the socket file on close
+	return acceptErr
+}
+
+// track adds or removes an open connection.
+func (s *controlServer) track(conn net.Conn, open bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if open {
+		s.conns[conn] = struct{}{}
+		return
+	}
+	delete(s.conns, conn)
+}
+
+// handle answers the requests of a connection until the client closes it or stays silent too long.
+func (s *controlServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.track(conn, false)
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		_ = conn.SetDeadline(time.Now().Add(time.Minute))
+		if !scanner.Scan() {
+			return
+		}
+
+		var req ControlRequest
+		var resp ControlResponse
+		var after func()
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", err)
+		} else {
+			resp, after = s.execute(req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+		// actions stopping the process run once the client got the answer
+		if after != nil {
+			after()
+		}
+	}
+}
+
+// execute runs a command and returns the response, with an action to run once it was sent.
+func (s *controlServer) execute(req ControlRequest) (resp ControlResponse, after func()) {
+	s.options.logger.Info("control command", "command", req.Command, "args", req.Args)
+
+	var result any
+	var err error
+	switch req.Command {
+	case "status":
+		result = s.status()
+	case "shutdown":
+		if controlFrom(s.ctx) == nil {
+			err = errors.New("process is not run with GracefulShutdown")
+			break
+		}
+		after = func() { TriggerShutdown(s.ctx, ErrControlShutdown) }
+		result = "shutdown triggered"
+	case "reload":
+		if s.options.reload == nil {
+			err = errors.New("reload is not configured")
+			break
+		}
+		err = s.options.reload()
+		result = "reloaded"
+	case "goroutines":
+		result = string(goroutineDump(true))
+	case "log-level":
+		result, err = s.logLevel(req.Args)
+	default:
+		err = fmt.Errorf("unknown command %q", req.Command)
+	}
+
+	if err != nil {
+		return ControlResponse{Error: err.Error()}, nil
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return ControlResponse{Error: fmt.Sprintf("encode result: %v", err)}, nil
+	}
+	return ControlResponse{OK: true, Result: raw}, after
+}
+
+// status reports the process state.
+func (s *controlServer) status() ControlStatus {
+	return processStatus(s.ctx)
+}
+
+// processStatus reports the state of the process, with the lifecycle and the servers if the context
+// comes from GracefulShutdown.
+func processStatus(ctx context.Context) ControlStatus {
+	st := ControlStatus{PID: os.Getpid(), Goroutines: runtime.NumGoroutine(), Servers: []ServerStatus{}}
+	if c := controlFrom(ctx); c != nil {
+		st.State = c.lifecycle.State().String()
+		st.Uptime = time.Since(c.started).Round(time.Second).String()
+		st.Servers = c.servers.list()
+	}
+	return st
+}
+
+// logLevel sets the level given in the arguments and returns the level in effect.
+func (s *controlServer) logLevel(args []string) (string, error) {
+	if s.options.logLevel == nil {
+		return "", errors.New("log level is not configured")
+	}
+	if len(args) > 0 {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(args[0])); err != nil {
+			return "", fmt.Errorf("invalid log level: %w", err)
+		}
+		s.options.logLevel.Set(level)
+	}
+	return s.options.logLevel.Level().String(), nil
+}
@@ -0,0 +1,173 @@
+package ctrl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// socketPath returns a short socket path, unix socket paths are limited to about a hundred bytes
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ctrl")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "ctrl.sock")
+}
+
+// controlClient sends requests over a single connection to the control socket
+type controlClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialControl(t *testing.T, path string) *controlClient {
+	t.Helper()
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(waitLimit)))
+	return &controlClient{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *controlClient) send(t *testing.T, line string) ControlResponse {
+	t.Helper()
+	_, err := c.conn.Write([]byte(line + "\n"))
+	require.NoError(t, err)
+	data, err := c.r.ReadBytes('\n')
+	require.NoError(t, err)
+	var resp ControlResponse
+	require.NoError(t, json.Unmarshal(data, &resp))
+	return resp
+}
+
+func TestRunControlSocket(t *testing.T) {
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("commands", func(t *testing.T) {
+		lc := NewLifecycle()
+		require.NoError(t, lc.Transition(StateReady))
+		ctx, cancel := GracefulShutdown(WithLifecycle(lc), WithLogger(discard), WithoutForceExit())
+		defer cancel()
+
+		level := &slog.LevelVar{}
+		var reloads atomic.Int32
+		path := socketPath(t)
+		errCh := RunControlSocket(ctx, path,
+			WithControlLogger(discard),
+			WithControlLogLevel(level),
+			WithControlReload(func() error { reloads.Add(1); return nil }),
+		)
+
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+		c := dialControl(t, path)
+
+		resp := c.send(t, `{"command":"status"}`)
+		require.True(t, resp.OK, resp.Error)
+		var st ControlStatus
+		require.NoError(t, json.Unmarshal(resp.Result, &st))
+		assert.Equal(t, os.Getpid(), st.PID)
+		assert.Equal(t, "ready", st.State)
+		assert.NotEmpty(t, st.Uptime)
+		require.Len(t, st.Servers, 1, "the control socket reports itself")
+		assert.Equal(t, ServerStatus{Kind: "control", Addr: path, Since: st.Servers[0].Since}, st.Servers[0])
+
+		resp = c.send(t, `{"command":"log-level","args":["debug"]}`)
+		require.True(t, resp.OK, resp.Error)
+		assert.JSONEq(t, `"DEBUG"`, string(resp.Result))
+		assert.Equal(t, slog.LevelDebug, level.Level())
+		resp = c.send(t, `{"command":"log-level","args":["loud"]}`)
+		assert.False(t, resp.OK)
+		assert.Contains(t, resp.Error, "invalid log level")
+
+		resp = c.send(t, `{"command":"reload"}`)
+		require.True(t, resp.OK, resp.Error)
+		assert.Equal(t, int32(1), reloads.Load())
+
+		resp = c.send(t, `{"command":"goroutines"}`)
+		require.True(t, resp.OK, resp.Error)
+		assert.Contains(t, string(resp.Result), "goroutine ")
+
+		resp = c.send(t, `{"command":"dance"}`)
+		assert.False(t, resp.OK)
+		assert.Equal(t, `unknown command "dance"`, resp.Error)
+		resp = c.send(t, `not json`)
+		assert.False(t, resp.OK)
+		assert.Contains(t, resp.Error, "invalid request")
+
+		resp = c.send(t, `{"command":"shutdown"}`)
+		require.True(t, resp.OK, resp.Error)
+		select {
+		case <-ctx.Done():
+		case <-time.After(waitLimit):
+			t.Fatal("shutdown command did not trigger the shutdown")
+		}
+		require.ErrorIs(t, context.Cause(ctx), ErrControlShutdown)
+
+		require.NoError(t, <-errCh)
+		_, err = os.Stat(path)
+		require.ErrorIs(t, err, os.ErrNotExist, "the socket file is removed")
+	})
+
+	t.Run("without graceful shutdown", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		path := socketPath(t)
+
+		// a socket file left by a crashed run is replaced
+		stale, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		errCh := RunControlSocket(ctx, path, WithControlLogger(discard))
+		c := dialControl(t, path)
+
+		resp := c.send(t, `{"command":"status"}`)
+		require.True(t, resp.OK, resp.Error)
+		assert.NotContains(t, string(resp.Result), `"state"`)
+		resp = c.send(t, `{"command":"shutdown"}`)
+		assert.False(t, resp.OK)
+		resp = c.send(t, `{"command":"reload"}`)
+		assert.Equal(t, "reload is not configured", resp.Error)
+
+		// open connections do not hold the stop
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("socket in use not taken over", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		path := socketPath(t)
+		errCh := RunControlSocket(ctx, path, WithControlLogger(discard))
+		dialControl(t, path)
+
+		err := <-RunControlSocket(context.Background(), path, WithControlLogger(discard))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is in use")
+		resp := dialControl(t, path).send(t, `{"command":"status"}`)
+		assert.True(t, resp.OK, "the first instance keeps serving")
+
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("listen error", func(t *testing.T) {
+		err := <-RunControlSocket(context.Background(), filepath.Join(socketPath(t), "missing", "ctrl.sock"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "listen on control socket")
+	})
+}
@@ -76,6 +76,19 @@
 //	    }),
 //	    ctrl.WithLogger(logger))
 //
+// # Process Lifecycle
+//
+// A Lifecycle tracks the process state and gives each stage its own context:
+//
+//	lc := ctrl.NewLifecycle()
+//	ctx, cancel := ctrl.GracefulShutdown(ctrl.WithLifecycle(lc), ctrl.WithDrainDelay(5*time.Second))
+//	defer cancel()
+//	go func() {
+//	    <-lc.Context(ctrl.StateDraining).Done()
+//	    registry.Deregister()
+//	}()
+//	_ = lc.Transition(ctrl.StateReady)
+//
 // # Best Practices
 //
 // Use assertions for internal invariants that should never fail in correct code:
@@ -0,0 +1,54 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// WithHTTPOnShutdown registers a callback started, along with the other ones, once the server shuts
+// down. Unlike the callbacks of Server.RegisterOnShutdown, they are awaited within the shutdown timeout
+// before the result is published, and their errors are joined into it. The context passed to them
+// expires with the shutdown timeout. Can be given several times.
+func WithHTTPOnShutdown(fn func(ctx context.Context) error) HTTPOption {
+	return func(o *httpOptions) {
+		o.onShutdown = append(o.onShutdown, fn)
+	}
+}
+
+// startCallbacks runs the callbacks concurrently, the returned function waits for them until the
+// context ends and returns their errors.
+func startCallbacks(ctx context.Context, fns []func(context.Context) error) (wait func() error) {
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for _, fn := range fns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("shutdown callback: %w", err))
+				mu.Unlock()
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return func() error {
+		var timeoutErr error
+		select {
+		case <-done:
+		case <-ctx.Done():
+			timeoutErr = fmt.Errorf("shutdown callbacks: %w", ctx.Err())
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return errors.Join(append(errs, timeoutErr)...)
+	}
+}
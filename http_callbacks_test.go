@@ -0,0 +1,98 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPOnShutdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("callbacks awaited and their errors reported", func(t *testing.T) {
+		var finished atomic.Int32
+		errFlush := errors.New("flush failed")
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPLogger(logger),
+			WithHTTPOnShutdown(func(context.Context) error {
+				time.Sleep(100 * time.Millisecond)
+				finished.Add(1)
+				return nil
+			}),
+			WithHTTPOnShutdown(func(context.Context) error {
+				finished.Add(1)
+				return errFlush
+			}),
+		)
+		require.NoError(t, err)
+
+		cancel()
+		err = <-h.Done()
+		require.ErrorIs(t, err, errFlush)
+		assert.Equal(t, int32(2), finished.Load(), "the result comes after the callbacks")
+	})
+
+	t.Run("failing callback does not force the server", func(t *testing.T) {
+		errFlush := errors.New("flush failed")
+		for _, opts := range [][]HTTPOption{nil, {WithHTTPForceClose(time.Second)}} {
+			var served atomic.Bool
+			server := &http.Server{Addr: freeAddr(t), ReadHeaderTimeout: time.Second}
+			ctx, cancel := context.WithCancel(context.Background())
+			opts = append(opts, WithHTTPLogger(logger),
+				WithHTTPOnShutdown(func(context.Context) error { return errFlush }))
+			errCh := RunHTTPServerWithContext(ctx, server, func() error {
+				err := server.ListenAndServe()
+				time.Sleep(100 * time.Millisecond)
+				served.Store(true)
+				return err
+			}, opts...)
+			require.Eventually(t, func() bool {
+				resp, err := (&http.Client{Timeout: waitLimit}).Get("http://" + server.Addr)
+				if err != nil {
+					return false
+				}
+				resp.Body.Close()
+				return true
+			}, waitLimit, 10*time.Millisecond)
+
+			cancel()
+			err := <-errCh
+			require.ErrorIs(t, err, errFlush)
+			assert.NotContains(t, err.Error(), "forcibly closed")
+			assert.True(t, served.Load(), "the result comes after the start function returned")
+		}
+	})
+
+	t.Run("callbacks bounded by the shutdown timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPLogger(logger), WithHTTPShutdownTimeout(50*time.Millisecond),
+			WithHTTPOnShutdown(func(ctx context.Context) error {
+				<-ctx.Done()
+				<-release // ignores the deadline
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+
+		cancel()
+		select {
+		case err := <-h.Done():
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Contains(t, err.Error(), "shutdown callbacks")
+		case <-time.After(waitLimit):
+			t.Fatal("the shutdown waited past its timeout")
+		}
+	})
+}
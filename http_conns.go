@@ -0,0 +1,145 @@
+package ctrl
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// connTracker follows the connections of a server through its ConnState hook.
+type connTracker struct {
+	mu         sync.Mutex
+	conns      map[net.Conn]http.ConnState
+	hijacked   map[net.Conn]struct{} // hijacked through the wrapped handler and not closed yet
+	lastActive time.Time             // the last moment a connection was new, active or hijacked
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: map[net.Conn]http.ConnState{}, hijacked: map[net.Conn]struct{}{}, lastActive: time.Now()}
+}
+
+// install chains the tracker into the ConnState hook of the server, keeping the hook already set, and
+// wraps the handler to follow hijacked connections until they are closed, e.g. WebSockets.
+// The returned function restores both.
+func (t *connTracker) install(server *http.Server) (restore func()) {
+	prevHandler, prevState := server.Handler, server.ConnState
+	handler := prevHandler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(&trackedWriter{ResponseWriter: w, tracker: t}, r)
+	})
+	server.ConnState = func(c net.Conn, s http.ConnState) {
+		t.connState(c, s)
+		if prevState != nil {
+			prevState(c, s)
+		}
+	}
+	return func() { server.Handler, server.ConnState = prevHandler, prevState }
+}
+
+// connState records the new state of the connection. Closed and hijacked connections are no longer
+// the server's and are forgotten, hijacked ones are followed by the wrapped handler instead.
+func (t *connTracker) connState(c net.Conn, s http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if prev, ok := t.conns[c]; (ok && isBusy(prev)) || isBusy(s) {
+		t.lastActive = time.Now()
+	}
+	switch s {
+	case http.StateClosed, http.StateHijacked:
+		delete(t.conns, c)
+	default:
+		t.conns[c] = s
+	}
+}
+
+// counts returns the number of connections serving or about to serve a request and of idle ones.
+func (t *connTracker) counts() (busy, idle int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.conns {
+		if isBusy(s) {
+			busy++
+		} else {
+			idle++
+		}
+	}
+	return busy, idle
+}
+
+// idleFor returns how long no connection has been new, active or hijacked, zero while one is.
+func (t *connTracker) idleFor() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.hijacked) > 0 {
+		return 0
+	}
+	for _, s := range t.conns {
+		if isBusy(s) {
+			return 0
+		}
+	}
+	return time.Since(t.lastActive)
+}
+
+// isBusy reports whether a connection in the state serves or is about to serve a request.
+func isBusy(s http.ConnState) bool {
+	return s == http.StateNew || s == http.StateActive
+}
+
+// hijack records a connection hijacked through the wrapped handler, or forgets it once closed.
+func (t *connTracker) hijack(c net.Conn, open bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastActive = time.Now()
+	if open {
+		t.hijacked[c] = struct{}{}
+		return
+	}
+	delete(t.hijacked, c)
+}
+
+// trackedWriter hands out the hijacked connection wrapped, so the tracker sees it busy until closed.
+type trackedWriter struct {
+	http.ResponseWriter
+	tracker *connTracker
+}
+
+// Hijack hijacks the connection of the underlying writer and records it.
+func (w *trackedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.tracker.hijack(conn, true)
+	return &trackedConn{Conn: conn, tracker: w.tracker}, brw, nil
+}
+
+// Flush keeps streaming responses working through the wrapper.
+func (w *trackedWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *trackedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// trackedConn reports its closing to the tracker.
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+// Close closes the connection and forgets it.
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.tracker.hijack(c.Conn, false) })
+	return err
+}
@@ -0,0 +1,69 @@
+package ctrl
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnTracker(t *testing.T) {
+	tracker := newConnTracker()
+	server := &http.Server{}
+	var chained []http.ConnState
+	server.ConnState = func(_ net.Conn, s http.ConnState) { chained = append(chained, s) }
+	var hijacked net.Conn
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		require.NoError(t, err)
+		hijacked = conn
+	})
+	restore := tracker.install(server)
+
+	c1, c2 := &net.TCPConn{}, &net.UnixConn{}
+	server.ConnState(c1, http.StateNew)
+	server.ConnState(c2, http.StateNew)
+	server.ConnState(c1, http.StateActive)
+	server.ConnState(c2, http.StateIdle)
+	busy, idle := tracker.counts()
+	assert.Equal(t, 1, busy)
+	assert.Equal(t, 1, idle)
+	assert.Zero(t, tracker.idleFor(), "a busy connection keeps it active")
+
+	// a connection hijacked through the handler, e.g. a WebSocket, is busy until closed
+	client, conn := net.Pipe()
+	defer client.Close()
+	server.Handler.ServeHTTP(&hijackableRecorder{ResponseRecorder: httptest.NewRecorder(), conn: conn},
+		httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	server.ConnState(c1, http.StateHijacked)
+	busy, idle = tracker.counts()
+	assert.Equal(t, 0, busy, "no longer the server's connection")
+	assert.Equal(t, 1, idle)
+	time.Sleep(10 * time.Millisecond)
+	assert.Zero(t, tracker.idleFor(), "an open hijacked connection blocks the idle shutdown")
+	require.NoError(t, hijacked.Close())
+	time.Sleep(10 * time.Millisecond)
+	assert.Positive(t, tracker.idleFor(), "idle once the hijacked connection closed")
+
+	assert.Len(t, chained, 5, "the hook already set is kept")
+	restore()
+	server.ConnState(c2, http.StateClosed)
+	assert.Len(t, chained, 6)
+	_, idle = tracker.counts()
+	assert.Equal(t, 1, idle, "a restored hook no longer feeds the tracker")
+}
+
+// hijackableRecorder is a recorder whose connection can be hijacked
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (r *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return r.conn, bufio.NewReadWriter(bufio.NewReader(r.conn), bufio.NewWriter(r.conn)), nil
+}
@@ -0,0 +1,114 @@
+package ctrl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrServerTimeouts is returned by a runner set with WithHTTPTimeoutCheck in strict mode when the
+// server timeouts are missing or inconsistent. The error wraps it with the problems found.
+var ErrServerTimeouts = errors.New("unsafe server timeouts")
+
+// ServerOption represents a functional option for NewHTTPServer.
+type ServerOption func(*http.Server)
+
+// WithServerTimeouts sets the read header, read, write and idle timeouts of the server.
+func WithServerTimeouts(readHeader, read, write, idle time.Duration) ServerOption {
+	return func(s *http.Server) {
+		s.ReadHeaderTimeout, s.ReadTimeout, s.WriteTimeout, s.IdleTimeout = readHeader, read, write, idle
+	}
+}
+
+// WithServerMaxHeaderBytes sets the maximum size of the request headers.
+func WithServerMaxHeaderBytes(n int) ServerOption {
+	return func(s *http.Server) {
+		s.MaxHeaderBytes = n
+	}
+}
+
+// WithServerLogger makes the server log its errors, e.g. TLS handshake failures, with the logger.
+func WithServerLogger(logger *slog.Logger) ServerOption {
+	return func(s *http.Server) {
+		s.ErrorLog = slog.NewLogLogger(logger.Handler(), slog.LevelWarn)
+	}
+}
+
+// NewHTTPServer returns a server with defaults safe against slow or oversized clients, which the zero
+// http.Server lacks: a 5 seconds ReadHeaderTimeout, 30 seconds ReadTimeout, 10 seconds WriteTimeout,
+// matching the default shutdown timeout of the runners, 2 minutes IdleTimeout and 64KB MaxHeaderBytes.
+// Handlers streaming for longer than the write timeout need a larger one, set with WithServerTimeouts
+// or per request with http.ResponseController.SetWriteDeadline.
+func NewHTTPServer(addr string, handler http.Handler, opts ...ServerOption) *http.Server {
+	s := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithHTTPTimeoutCheck makes the runner inspect the timeouts of the server before starting it and log
+// a warning for each one missing or inconsistent with the shutdown timeout. In strict mode the server
+// is not started and the problems are reported on the result channel as an error wrapping
+// ErrServerTimeouts.
+func WithHTTPTimeoutCheck(strict bool) HTTPOption {
+	return func(o *httpOptions) {
+		o.timeoutCheck = true
+		o.timeoutStrict = strict
+	}
+}
+
+// withoutTimeoutCheck turns the check off for a server checked before its run already.
+func withoutTimeoutCheck() HTTPOption {
+	return func(o *httpOptions) {
+		o.timeoutCheck = false
+	}
+}
+
+// checkTimeouts returns the problems found with the timeouts of the server.
+func checkTimeouts(s *http.Server, shutdownTimeout time.Duration) []string {
+	var problems []string
+	if s.ReadHeaderTimeout <= 0 && s.ReadTimeout <= 0 {
+		problems = append(problems, "no ReadHeaderTimeout or ReadTimeout, slow clients can hold connections forever")
+	}
+	if s.IdleTimeout <= 0 && s.ReadTimeout <= 0 {
+		problems = append(problems, "no IdleTimeout or ReadTimeout, idle keep-alive connections never expire")
+	}
+	if s.MaxHeaderBytes <= 0 {
+		problems = append(problems, "no MaxHeaderBytes, request headers may take up to 1MB")
+	}
+	if s.WriteTimeout <= 0 {
+		problems = append(problems, "no WriteTimeout, a response may run for longer than any shutdown timeout")
+	}
+	if s.WriteTimeout > shutdownTimeout {
+		problems = append(problems, fmt.Sprintf("WriteTimeout %s exceeds the shutdown timeout %s, requests may be cut by the shutdown",
+			s.WriteTimeout, shutdownTimeout))
+	}
+	return problems
+}
+
+// timeoutsError logs the problems with the server timeouts and returns them as an error in strict mode.
+func timeoutsError(s *http.Server, options httpOptions) error {
+	if !options.timeoutCheck {
+		return nil
+	}
+	problems := checkTimeouts(s, options.shutdownTimeout)
+	for _, p := range problems {
+		options.logger.Warn("unsafe server timeouts", "addr", s.Addr, "problem", p)
+	}
+	if !options.timeoutStrict || len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrServerTimeouts, strings.Join(problems, "; "))
+}
@@ -0,0 +1,73 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	handler := http.NotFoundHandler()
+	s := NewHTTPServer(":8080", handler)
+	assert.Equal(t, ":8080", s.Addr)
+	assert.NotNil(t, s.Handler)
+	assert.Equal(t, 5*time.Second, s.ReadHeaderTimeout)
+	assert.Equal(t, 64<<10, s.MaxHeaderBytes)
+	assert.Empty(t, checkTimeouts(s, 10*time.Second), "the defaults pass the check")
+
+	s = NewHTTPServer(":8080", handler, WithServerTimeouts(time.Second, 2*time.Second, 3*time.Second, 4*time.Second),
+		WithServerMaxHeaderBytes(1024), WithServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	assert.Equal(t, time.Second, s.ReadHeaderTimeout)
+	assert.Equal(t, 2*time.Second, s.ReadTimeout)
+	assert.Equal(t, 3*time.Second, s.WriteTimeout)
+	assert.Equal(t, 4*time.Second, s.IdleTimeout)
+	assert.Equal(t, 1024, s.MaxHeaderBytes)
+	assert.NotNil(t, s.ErrorLog)
+}
+
+func TestHTTPTimeoutCheck(t *testing.T) {
+	assert.Len(t, checkTimeouts(&http.Server{}, time.Second), 4)
+	noWrite := NewHTTPServer("", nil, WithServerTimeouts(time.Second, 2*time.Second, 0, time.Minute))
+	problems := checkTimeouts(noWrite, 10*time.Second)
+	require.Len(t, problems, 1, "no write timeout is no limit at all")
+	assert.Contains(t, problems[0], "no WriteTimeout")
+	problems = checkTimeouts(NewHTTPServer("", nil), 5*time.Second)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "exceeds the shutdown timeout")
+
+	t.Run("warnings logged, server started", func(t *testing.T) {
+		logs := &lockedBuffer{}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, &http.Server{Addr: "localhost:0"}, WithHTTPTimeoutCheck(false),
+			WithHTTPLogger(slog.New(slog.NewTextHandler(logs, nil))))
+		require.NoError(t, err)
+		cancel()
+		require.NoError(t, <-h.Done())
+		assert.Contains(t, logs.String(), "no ReadHeaderTimeout")
+		assert.Contains(t, logs.String(), "no MaxHeaderBytes")
+	})
+
+	t.Run("strict mode refuses the server", func(t *testing.T) {
+		logger := WithHTTPLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		_, err := StartHTTPServer(context.Background(), &http.Server{Addr: "localhost:0"}, WithHTTPTimeoutCheck(true), logger)
+		require.ErrorIs(t, err, ErrServerTimeouts)
+
+		started := false
+		err = <-RunHTTPServerWithContext(context.Background(), &http.Server{},
+			func() error { started = true; return nil }, WithHTTPTimeoutCheck(true), logger)
+		require.ErrorIs(t, err, ErrServerTimeouts)
+		assert.False(t, started)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, NewHTTPServer("localhost:0", nil), WithHTTPTimeoutCheck(true), logger)
+		require.NoError(t, err)
+		cancel()
+		require.NoError(t, <-h.Done())
+	})
+}
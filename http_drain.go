@@ -0,0 +1,113 @@
+package ctrl
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithHTTPDrainPeriod keeps the server accepting for the given period once it starts draining, before
+// the graceful shutdown closes its listeners. Throughout the drain phase keep-alives are disabled, so
+// HTTP/1.1 responses carry "Connection: close" and HTTP/2 clients receive GOAWAY, moving clients to
+// other instances before the server stops accepting. The period counts from the moment the drain
+// starts, so with a context from GracefulShutdown the drain delay is part of it. The shutdown timeout
+// counts from the end of the period, the timeout of GracefulShutdown has to cover both.
+func WithHTTPDrainPeriod(period time.Duration) HTTPOption {
+	return func(o *httpOptions) {
+		o.drainPeriod = period
+	}
+}
+
+// Draining returns a channel closed once the server serving the request starts shutting down, for
+// long-poll, SSE and streaming handlers to send a final event and return instead of holding the
+// shutdown until its timeout. It fires when the process enters StateDraining if the server runs with
+// a context from GracefulShutdown, otherwise when the server's context is canceled. The request
+// context is expected; it returns nil, a channel never closed, for a server not run by this package.
+func Draining(ctx context.Context) <-chan struct{} {
+	if d, ok := ctx.Value(drainSignalKey{}).(*drainSignal); ok {
+		return d.ch
+	}
+	return nil
+}
+
+// drainSignalKey is the context key of the drain signal of a server.
+type drainSignalKey struct{}
+
+// drainSignal is closed once the server starts draining, which turns the server's keep-alives off.
+type drainSignal struct {
+	ch      chan struct{}
+	once    sync.Once
+	server  *http.Server
+	started time.Time // the moment the drain started, set once ch is closed
+}
+
+func newDrainSignal() *drainSignal {
+	return &drainSignal{ch: make(chan struct{})}
+}
+
+// install chains the signal into the base context of the server, so every request context carries it,
+// and wraps the handler to close the connections of requests coming in while draining. The returned
+// function restores the original hooks.
+func (d *drainSignal) install(server *http.Server) (restore func()) {
+	d.server = server
+	prevHandler := server.Handler
+	handler := prevHandler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-d.ch:
+			// makes HTTP/2 connections send GOAWAY, HTTP/1.1 ones get it from the disabled keep-alives
+			w.Header().Set("Connection", "close")
+		default:
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	prev := server.BaseContext
+	server.BaseContext = func(l net.Listener) context.Context {
+		ctx := context.Background()
+		if prev != nil {
+			ctx = prev(l)
+		}
+		return context.WithValue(ctx, drainSignalKey{}, d)
+	}
+	return func() { server.Handler, server.BaseContext = prevHandler, prev }
+}
+
+// start fires the signal and disables keep-alives, which also closes the idle connections.
+// Repeated calls do nothing.
+func (d *drainSignal) start() {
+	d.once.Do(func() {
+		d.started = time.Now()
+		if d.server != nil {
+			d.server.SetKeepAlivesEnabled(false)
+		}
+		close(d.ch)
+	})
+}
+
+// wait waits until the drain lasted for the period, counting from its start.
+func (d *drainSignal) wait(period time.Duration) {
+	d.start()
+	if remaining := period - time.Since(d.started); remaining > 0 {
+		time.Sleep(remaining)
+	}
+}
+
+// watch fires the signal once the process the context comes from starts draining, until the context
+// ends. It does nothing for a context not from GracefulShutdown.
+func (d *drainSignal) watch(ctx context.Context) {
+	c := controlFrom(ctx)
+	if c == nil {
+		return
+	}
+	select {
+	case <-c.lifecycle.Context(StateDraining).Done():
+		d.start()
+	case <-ctx.Done():
+	}
+}
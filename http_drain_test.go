@@ -0,0 +1,189 @@
+package ctrl
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDraining(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// stream sends an event, then a final one once the server drains
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "data: start\n")
+		_ = http.NewResponseController(w).Flush()
+		select {
+		case <-Draining(r.Context()):
+			_, _ = io.WriteString(w, "data: final\n")
+		case <-r.Context().Done():
+		}
+	})
+
+	// openStream starts a streaming request and returns its reader once the first event arrived
+	openStream := func(t *testing.T, addr string) *bufio.Reader {
+		t.Helper()
+		resp, err := http.Get("http://" + addr)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		r := bufio.NewReader(resp.Body)
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "data: start\n", line)
+		return r
+	}
+
+	t.Run("streaming handler returns once the shutdown starts", func(t *testing.T) {
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second, Handler: stream}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPLogger(logger), WithHTTPShutdownTimeout(time.Hour))
+		require.NoError(t, err)
+		r := openStream(t, h.Addr().String())
+
+		cancel()
+		select {
+		case err := <-h.Done():
+			require.NoError(t, err)
+		case <-time.After(waitLimit):
+			t.Fatal("the shutdown waited for the streaming handler")
+		}
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "data: final\n", line)
+	})
+
+	t.Run("fires as the process enters draining", func(t *testing.T) {
+		lc := NewLifecycle()
+		ctx, cancel := GracefulShutdown(WithLifecycle(lc), WithDrainDelay(time.Hour),
+			WithLogger(logger), WithoutForceExit())
+		defer cancel()
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second, Handler: stream}
+		h, err := StartHTTPServer(ctx, server, WithHTTPLogger(logger))
+		require.NoError(t, err)
+		r := openStream(t, h.Addr().String())
+
+		require.True(t, TriggerShutdown(ctx, errors.New("test")))
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "data: final\n", line)
+		assert.Equal(t, StateDraining, lc.State())
+		require.NoError(t, ctx.Err(), "the server context is still running, the drain delay did not pass")
+
+		cancel()
+		require.NoError(t, <-h.Done())
+	})
+
+	t.Run("no signal outside the runner", func(t *testing.T) {
+		assert.Nil(t, Draining(context.Background()))
+	})
+}
+
+func TestHTTPDrainPeriod(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	// get sends a request and reports whether it went over a reused connection
+	get := func(t *testing.T, client *http.Client, url string) (resp *http.Response, reused bool) {
+		t.Helper()
+		trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused }}
+		req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, url, http.NoBody)
+		require.NoError(t, err)
+		resp, err = client.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp, reused
+	}
+
+	t.Run("keep-alives off while still accepting", func(t *testing.T) {
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second, Handler: ok}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPLogger(logger), WithHTTPDrainPeriod(300*time.Millisecond))
+		require.NoError(t, err)
+		url := "http://" + h.Addr().String()
+		client := &http.Client{Timeout: waitLimit, Transport: &http.Transport{}}
+
+		resp, _ := get(t, client, url)
+		assert.False(t, resp.Close, "keep-alive before the drain")
+
+		start := time.Now()
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		resp, _ = get(t, client, url)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "still accepting")
+		assert.True(t, resp.Close, "the connection is closed after the response")
+		resp, reused := get(t, client, url)
+		assert.True(t, resp.Close)
+		assert.False(t, reused)
+
+		require.NoError(t, <-h.Done())
+		assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	})
+
+	t.Run("HTTP/2 clients move to a new connection", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		writeCert(t, certFile, keyFile, 1)
+		server := &http.Server{Addr: freeAddr(t), ReadHeaderTimeout: time.Second, Handler: ok}
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunHTTPSServerWithContext(ctx, server, certFile, keyFile, WithHTTPLogger(logger),
+			WithHTTPDrainPeriod(time.Second))
+		servedSerial(t, server.Addr)
+		url := "https://" + server.Addr
+		client := &http.Client{Timeout: waitLimit, Transport: &http.Transport{ForceAttemptHTTP2: true,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+		resp, _ := get(t, client, url)
+		require.Equal(t, 2, resp.ProtoMajor)
+		_, reused := get(t, client, url)
+		require.True(t, reused)
+
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		require.Eventually(t, func() bool {
+			resp, reused := get(t, client, url)
+			return resp.StatusCode == http.StatusOK && !reused
+		}, 900*time.Millisecond, 10*time.Millisecond, "GOAWAY moves the client to a new connection")
+
+		require.NoError(t, <-errCh)
+	})
+	t.Run("shutdown timeout counts after the period", func(t *testing.T) {
+		inFlight := make(chan struct{})
+		slow := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			close(inFlight)
+			time.Sleep(400 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		})
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second, Handler: slow}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPLogger(logger), WithHTTPDrainPeriod(300*time.Millisecond),
+			WithHTTPShutdownTimeout(200*time.Millisecond), WithHTTPForceClose(50*time.Millisecond))
+		require.NoError(t, err)
+		status := make(chan int, 1)
+		go func() {
+			resp, err := (&http.Client{Timeout: waitLimit}).Get("http://" + h.Addr().String())
+			if err != nil {
+				status <- 0
+				return
+			}
+			resp.Body.Close()
+			status <- resp.StatusCode
+		}()
+		<-inFlight
+
+		cancel()
+		require.NoError(t, <-h.Done(), "the period does not use up the shutdown timeout")
+		assert.Equal(t, http.StatusOK, <-status)
+	})
+}
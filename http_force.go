@@ -0,0 +1,30 @@
+package ctrl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WithHTTPForceClose makes the runner close the server with Server.Close once the shutdown timeout
+// expired, dropping the connections still open, and wait up to the grace period for the start function
+// to return, so the result published means the server is gone. The shutdown error then also reports
+// how many connections were dropped.
+func WithHTTPForceClose(grace time.Duration) HTTPOption {
+	return func(o *httpOptions) {
+		o.forceCloseGrace = grace
+	}
+}
+
+// forceClose closes the server and all its connections, reporting how many were dropped.
+func forceClose(server *http.Server, tracker *connTracker, logger *slog.Logger) error {
+	busy, idle := tracker.counts()
+	logger.Warn("forcibly closing HTTP server", "connections", busy+idle)
+	err := fmt.Errorf("forcibly closed %d connections", busy+idle)
+	if closeErr := server.Close(); closeErr != nil {
+		return errors.Join(err, fmt.Errorf("close server: %w", closeErr))
+	}
+	return err
+}
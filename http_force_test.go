@@ -0,0 +1,50 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPForceClose(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			close(started)
+			<-release // ignores the request context, as stuck handlers do
+			w.WriteHeader(http.StatusOK)
+		})}
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := StartHTTPServer(ctx, server, WithHTTPLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithHTTPShutdownTimeout(50*time.Millisecond), WithHTTPForceClose(time.Second))
+	require.NoError(t, err)
+
+	clientErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + h.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		clientErr <- err
+	}()
+	<-started
+
+	cancel()
+	err = <-h.Done()
+	require.Error(t, err)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "forcibly closed 1 connections")
+	select {
+	case err := <-clientErr:
+		require.Error(t, err, "the connection was dropped")
+	case <-time.After(waitLimit):
+		t.Fatal("the connection was not closed")
+	}
+}
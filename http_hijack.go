@@ -0,0 +1,166 @@
+package ctrl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// WithHTTPHijackTracking makes the runner track the connections hijacked from the server, e.g.
+// WebSockets, which http.Server.Shutdown ignores. Once the shutdown starts their handlers are notified
+// through HijackShutdown, the shutdown waits for the connections to be closed within its timeout, and
+// the ones still open after that are closed. The server handler is wrapped to watch the connections
+// returned by Hijack; connections hijacked around it, seen only through the ConnState hook, can't be
+// watched closing and are closed once the watched ones are done.
+func WithHTTPHijackTracking() HTTPOption {
+	return func(o *httpOptions) {
+		o.hijackTracking = true
+	}
+}
+
+// HijackShutdown returns a channel closed once the server serving the request starts shutting down,
+// at the same moment as Draining, for a handler that hijacked the connection to know when to say
+// goodbye to its client and close it.
+// The request context is expected; it returns nil, a channel never closed, if the server is not run
+// with WithHTTPHijackTracking.
+func HijackShutdown(ctx context.Context) <-chan struct{} {
+	if t, ok := ctx.Value(hijackTrackerKey{}).(*hijackTracker); ok {
+		return t.draining
+	}
+	return nil
+}
+
+// hijackTrackerKey is the request context key of the tracker of the server.
+type hijackTrackerKey struct{}
+
+// hijackTracker keeps the hijacked connections of a server.
+type hijackTracker struct {
+	mu      sync.Mutex
+	conns   map[net.Conn]bool // true if its closing is watched through the wrapped handler
+	changed chan struct{}     // closed and replaced each time a watched connection closes
+
+	draining <-chan struct{} // closed once the server starts draining
+}
+
+func newHijackTracker(draining <-chan struct{}) *hijackTracker {
+	return &hijackTracker{conns: map[net.Conn]bool{}, changed: make(chan struct{}), draining: draining}
+}
+
+// install wraps the handler of the server and chains the tracker into its ConnState hook.
+// The returned function restores both.
+func (t *hijackTracker) install(server *http.Server) (restore func()) {
+	prevHandler, prevState := server.Handler, server.ConnState
+	handler := prevHandler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), hijackTrackerKey{}, t)
+		handler.ServeHTTP(&hijackWriter{ResponseWriter: w, tracker: t}, r.WithContext(ctx))
+	})
+	server.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateHijacked {
+			t.add(c, false)
+		}
+		if prevState != nil {
+			prevState(c, s)
+		}
+	}
+	return func() { server.Handler, server.ConnState = prevHandler, prevState }
+}
+
+// add records a hijacked connection, watched tells whether its closing is observed.
+func (t *hijackTracker) add(c net.Conn, watched bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conns[c] = t.conns[c] || watched
+}
+
+// remove forgets a connection closed by its owner.
+func (t *hijackTracker) remove(c net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, c)
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// wait waits until the watched connections are closed or the context ends, then closes the ones still
+// open. It returns an error if a watched connection had to be closed.
+func (t *hijackTracker) wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		watched := 0
+		for _, w := range t.conns {
+			if w {
+				watched++
+			}
+		}
+		changed := t.changed
+		t.mu.Unlock()
+		if watched == 0 {
+			t.closeAll()
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			t.closeAll()
+			return fmt.Errorf("%d hijacked connections closed: %w", watched, ctx.Err())
+		}
+	}
+}
+
+// closeAll closes the remaining connections.
+func (t *hijackTracker) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for c := range t.conns {
+		_ = c.Close()
+		delete(t.conns, c)
+	}
+}
+
+// hijackWriter hands out the hijacked connection wrapped, so its closing is seen by the tracker.
+type hijackWriter struct {
+	http.ResponseWriter
+	tracker *hijackTracker
+}
+
+// Hijack hijacks the connection of the underlying writer and starts watching it.
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.tracker.add(conn, true)
+	return &hijackedConn{Conn: conn, tracker: w.tracker}, brw, nil
+}
+
+// Flush keeps streaming responses working through the wrapper.
+func (w *hijackWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *hijackWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// hijackedConn reports its closing to the tracker.
+type hijackedConn struct {
+	net.Conn
+	tracker *hijackTracker
+	once    sync.Once
+}
+
+// Close closes the connection and forgets it.
+func (c *hijackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.tracker.remove(c.Conn) })
+	return err
+}
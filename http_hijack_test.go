@@ -0,0 +1,113 @@
+package ctrl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHijackTracking(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// dialHijacked sends a request to the server and returns the connection once the handler hijacked it
+	dialHijacked := func(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		_, err = fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+		require.NoError(t, err)
+		r := bufio.NewReader(conn)
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "hijacked\n", line)
+		return conn, r
+	}
+
+	t.Run("owners notified and awaited", func(t *testing.T) {
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				shutdown := HijackShutdown(r.Context())
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					return
+				}
+				_, _ = fmt.Fprint(conn, "hijacked\n")
+				<-shutdown
+				time.Sleep(50 * time.Millisecond) // goodbye takes a while, the shutdown waits for it
+				_, _ = fmt.Fprint(conn, "bye\n")
+				conn.Close()
+			})}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPHijackTracking(), WithHTTPLogger(logger))
+		require.NoError(t, err)
+		conn, r := dialHijacked(t, h.Addr().String())
+		defer conn.Close()
+
+		cancel()
+		require.NoError(t, <-h.Done())
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "bye\n", line, "the connection was closed by its owner")
+	})
+
+	t.Run("stragglers closed after the timeout", func(t *testing.T) {
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				conn, _, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					return
+				}
+				_, _ = fmt.Fprint(conn, "hijacked\n") // and the connection is forgotten
+			})}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPHijackTracking(), WithHTTPLogger(logger),
+			WithHTTPShutdownTimeout(100*time.Millisecond))
+		require.NoError(t, err)
+		conn, r := dialHijacked(t, h.Addr().String())
+		defer conn.Close()
+
+		cancel()
+		err = <-h.Done()
+		require.Error(t, err)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "1 hijacked connections closed")
+		_ = conn.SetReadDeadline(time.Now().Add(waitLimit))
+		_, err = r.ReadString('\n')
+		require.ErrorIs(t, err, io.EOF, "the connection was closed by the shutdown")
+	})
+
+	t.Run("no notification without tracking", func(t *testing.T) {
+		var shutdown <-chan struct{}
+		handler := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { shutdown = HijackShutdown(r.Context()) })
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+		assert.Nil(t, shutdown)
+	})
+}
+
+func TestHijackTracker(t *testing.T) {
+	tracker := newHijackTracker(make(chan struct{}))
+	server := &http.Server{}
+	restore := tracker.install(server)
+	require.NotNil(t, server.Handler)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	server.ConnState(c1, http.StateHijacked)
+	require.NoError(t, tracker.wait(context.Background()), "a connection seen through ConnState only is not awaited")
+	_, err := c1.Write([]byte("x"))
+	require.ErrorIs(t, err, io.ErrClosedPipe, "but it is closed")
+
+	restore()
+	assert.Nil(t, server.Handler)
+	assert.Nil(t, server.ConnState)
+}
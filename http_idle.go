@@ -0,0 +1,40 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrIdleTimeout is the shutdown cause recorded when an HTTP server run with WithHTTPIdleShutdown
+// had no requests for the idle period. The cause wraps it with the details.
+var ErrIdleTimeout = errors.New("idle timeout")
+
+// WithHTTPIdleShutdown makes the runner shut down once the server had no active or new connections
+// for the given period, for scale-to-zero deployments. A connection hijacked by a handler, e.g. a
+// WebSocket, counts as active until it is closed. If the context comes from GracefulShutdown the
+// whole process shuts down with ErrIdleTimeout as the cause, otherwise only the server does.
+func WithHTTPIdleShutdown(idle time.Duration) HTTPOption {
+	return func(o *httpOptions) {
+		o.idleTimeout = idle
+	}
+}
+
+// watchIdle reports the idle cause once the tracked connections were idle for the period, unless the
+// context ends first.
+func watchIdle(ctx context.Context, tracker *connTracker, idle time.Duration, onIdle func(cause error)) {
+	ticker := time.NewTicker(max(idle/10, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if tracker.idleFor() >= idle {
+			onIdle(fmt.Errorf("%w: no requests for %s", ErrIdleTimeout, idle))
+			return
+		}
+	}
+}
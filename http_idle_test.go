@@ -0,0 +1,125 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHTTPServerIdleShutdown(t *testing.T) {
+	t.Run("server stops after the idle period", func(t *testing.T) {
+		handlerStarted, releaseHandler := make(chan struct{}), make(chan struct{})
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			close(handlerStarted)
+			<-releaseHandler
+			w.WriteHeader(http.StatusOK)
+		})}
+		listener, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+
+		logs := &lockedBuffer{}
+		errCh := RunHTTPServerWithContext(context.Background(), server, func() error { return server.Serve(listener) },
+			WithHTTPIdleShutdown(100*time.Millisecond),
+			WithHTTPLogger(slog.New(slog.NewTextHandler(logs, nil))),
+		)
+
+		respCh := make(chan error, 1)
+		go func() {
+			client := &http.Client{Timeout: 30 * time.Second}
+			resp, reqErr := client.Get("http://" + listener.Addr().String())
+			if reqErr == nil {
+				resp.Body.Close()
+			}
+			respCh <- reqErr
+		}()
+
+		// a running request keeps the server up well past the idle period
+		<-handlerStarted
+		select {
+		case err := <-errCh:
+			t.Fatalf("server stopped while a request was running: %v", err)
+		case <-time.After(300 * time.Millisecond):
+		}
+		close(releaseHandler)
+		require.NoError(t, <-respCh)
+
+		select {
+		case err := <-errCh:
+			require.NoError(t, err)
+		case <-time.After(waitLimit):
+			t.Fatal("idle server did not stop")
+		}
+		assert.Contains(t, logs.String(), "HTTP server idle, shutting down")
+	})
+
+	t.Run("idle server shuts the process down", func(t *testing.T) {
+		ctx, cancel := GracefulShutdown(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), WithoutForceExit())
+		defer cancel()
+
+		server := &http.Server{Handler: http.NotFoundHandler()}
+		listener, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		errCh := RunHTTPServerWithContext(ctx, server, func() error { return server.Serve(listener) },
+			WithHTTPIdleShutdown(50*time.Millisecond),
+			WithHTTPLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(waitLimit):
+			t.Fatal("idle server did not trigger the shutdown")
+		}
+		require.ErrorIs(t, context.Cause(ctx), ErrIdleTimeout)
+		require.NoError(t, <-errCh)
+	})
+	t.Run("open hijacked connection keeps the server up", func(t *testing.T) {
+		closed := make(chan struct{})
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				return
+			}
+			// a WebSocket-style session, busy well past the idle period
+			for range 20 {
+				if _, err := conn.Write([]byte("tick\n")); err != nil {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			conn.Close()
+			close(closed)
+		})}
+		listener, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		errCh := RunHTTPServerWithContext(context.Background(), server, func() error { return server.Serve(listener) },
+			WithHTTPIdleShutdown(150*time.Millisecond),
+			WithHTTPLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		)
+
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+		require.NoError(t, err)
+		go func() { _, _ = io.Copy(io.Discard, conn) }()
+
+		select {
+		case err := <-errCh:
+			t.Fatalf("server stopped while a hijacked connection was open: %v", err)
+		case <-closed:
+		}
+		select {
+		case err := <-errCh:
+			require.NoError(t, err)
+		case <-time.After(waitLimit):
+			t.Fatal("idle server did not stop after the hijacked connection closed")
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package ctrl
+
+import (
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WithHTTPDrainProgress makes the runner log, every interval from the start of the shutdown until the
+// server stopped, the number of active and idle connections and of requests in flight, and a summary
+// once it stopped, so operators can tell a drain that progresses from one that is stuck.
+func WithHTTPDrainProgress(interval time.Duration) HTTPOption {
+	return func(o *httpOptions) {
+		o.drainProgress = interval
+	}
+}
+
+// requestCounter counts the requests served by a server.
+type requestCounter struct {
+	inFlight  atomic.Int64
+	completed atomic.Int64
+}
+
+// install wraps the handler of the server, the returned function restores it.
+func (c *requestCounter) install(server *http.Server) (restore func()) {
+	prev := server.Handler
+	handler := prev
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.inFlight.Add(1)
+		defer func() {
+			c.inFlight.Add(-1)
+			c.completed.Add(1)
+		}()
+		handler.ServeHTTP(w, r)
+	})
+	return func() { server.Handler = prev }
+}
+
+// startDrainProgress logs the progress of the drain every interval until the returned function is
+// called, which logs the summary.
+func startDrainProgress(tracker *connTracker, requests *requestCounter, interval time.Duration,
+	logger *slog.Logger) (stop func()) {
+	started, completed := time.Now(), requests.completed.Load()
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				busy, idle := tracker.counts()
+				logger.Info("HTTP server drain progress", "elapsed", time.Since(started).Round(time.Millisecond),
+					"active", busy, "idle", idle, "in_flight", requests.inFlight.Load())
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+		busy, idle := tracker.counts()
+		logger.Info("HTTP server drain finished", "elapsed", time.Since(started).Round(time.Millisecond),
+			"completed", requests.completed.Load()-completed, "active", busy, "idle", idle,
+			"in_flight", requests.inFlight.Load())
+	}
+}
@@ -0,0 +1,55 @@
+package ctrl
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPDrainProgress(t *testing.T) {
+	inFlight, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		close(inFlight)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	logs := &lockedBuffer{}
+	server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second, Handler: mux}
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := StartHTTPServer(ctx, server, WithHTTPLogger(slog.New(slog.NewTextHandler(logs, nil))),
+		WithHTTPDrainProgress(20*time.Millisecond))
+	require.NoError(t, err)
+
+	slowStatus := make(chan int, 1)
+	go func() {
+		resp, err := (&http.Client{Timeout: waitLimit}).Get("http://" + h.Addr().String() + "/slow")
+		if err != nil {
+			slowStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		slowStatus <- resp.StatusCode
+	}()
+	<-inFlight
+
+	cancel()
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), "HTTP server drain progress")
+	}, waitLimit, 5*time.Millisecond)
+	assert.Contains(t, logs.String(), "active=1 idle=0 in_flight=1", "the request holding the drain is reported")
+	assert.NotContains(t, logs.String(), "HTTP server drain finished")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-slowStatus)
+	require.NoError(t, <-h.Done())
+	assert.Contains(t, logs.String(), "HTTP server drain finished")
+	assert.Contains(t, logs.String(), "completed=1 active=0 idle=0 in_flight=0")
+}
@@ -0,0 +1,63 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WithHTTPRestart makes the runner restart a server failing on its own with the policy, calling
+// startFn again on the same server after a backoff, e.g. while the address is still held by the
+// previous process during a rolling restart. Each restart is logged; the result is published only once
+// the policy gives up, the failure is not retryable or the context ends, with the last failure. It is
+// meant for start functions binding the address themselves, like ListenAndServe.
+func WithHTTPRestart(policy RestartPolicy) HTTPOption {
+	return func(o *httpOptions) {
+		o.restart = &policy
+	}
+}
+
+// restartHTTPServer runs the server, restarting it with the policy while it fails on its own.
+func restartHTTPServer(ctx context.Context, server *http.Server, startFn func() error, policy RestartPolicy,
+	logger *slog.Logger, opts []HTTPOption) <-chan httpResult {
+	resCh := make(chan httpResult, 1)
+	go func() {
+		runOpts := opts
+		restarts := 0
+		for {
+			started := time.Now()
+			res := <-runHTTPServerOnce(ctx, server, startFn, runOpts...)
+			// the server was checked on the first run, the warnings are not repeated with every restart
+			runOpts = append(opts[:len(opts):len(opts)], withoutTimeoutCheck())
+
+			if !res.self || res.serve == nil || errors.Is(res.serve, ErrServerTimeouts) ||
+				!policy.retryable(res.serve) || ctx.Err() != nil {
+				resCh <- res
+				return
+			}
+			if policy.ResetAfter > 0 && time.Since(started) >= policy.ResetAfter {
+				restarts = 0
+			}
+			if policy.exhausted(restarts) {
+				logger.Error("HTTP server failed, giving up", "restarts", restarts, "error", res.serve)
+				resCh <- res
+				return
+			}
+
+			restarts++
+			wait := policy.backoff(restarts, randInt64N)
+			logger.Warn("HTTP server failed, restarting", "attempt", restarts, "backoff", wait, "error", res.serve)
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				resCh <- res
+				return
+			}
+		}
+	}()
+	return resCh
+}
@@ -0,0 +1,102 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestartPolicy(t *testing.T) {
+	noJitter := func(int64) int64 { return 0 }
+	p := RestartPolicy{}
+	assert.Equal(t, 100*time.Millisecond, p.backoff(1, noJitter))
+	assert.Equal(t, 400*time.Millisecond, p.backoff(3, noJitter))
+	assert.Equal(t, 30*time.Second, p.backoff(50, noJitter), "capped")
+
+	p = RestartPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second, Jitter: 0.5}
+	assert.Equal(t, 2*time.Second, p.backoff(2, noJitter))
+	assert.Equal(t, 3*time.Second+1500*time.Millisecond-1, p.backoff(5, func(n int64) int64 { return n - 1 }))
+
+	assert.False(t, p.exhausted(100))
+	p.MaxAttempts = 2
+	assert.False(t, p.exhausted(1))
+	assert.True(t, p.exhausted(2))
+
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer l.Close()
+	_, err = net.Listen("tcp", l.Addr().String())
+	require.Error(t, err)
+	assert.True(t, RetryableServeError(err))
+	assert.False(t, RetryableServeError(errors.New("bad config")))
+	assert.True(t, RestartPolicy{Retryable: func(error) bool { return true }}.retryable(errors.New("any")))
+}
+
+func TestHTTPRestart(t *testing.T) {
+	policy := RestartPolicy{InitialBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+
+	t.Run("restarted once the address is released", func(t *testing.T) {
+		held, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		logs := &lockedBuffer{}
+		server := &http.Server{Addr: held.Addr().String(), ReadHeaderTimeout: time.Second,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })}
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunHTTPServerWithContext(ctx, server, server.ListenAndServe, WithHTTPRestart(policy),
+			WithHTTPLogger(slog.New(slog.NewTextHandler(logs, nil))))
+
+		require.Eventually(t, func() bool { return strings.Contains(logs.String(), "restarting") },
+			waitLimit, 10*time.Millisecond)
+		require.NoError(t, held.Close())
+		require.Eventually(t, func() bool {
+			resp, err := http.Get("http://" + server.Addr)
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK
+		}, waitLimit, 10*time.Millisecond)
+
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		held, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		defer held.Close()
+		logs := &lockedBuffer{}
+		var starts atomic.Int32
+		server := &http.Server{Addr: held.Addr().String(), ReadHeaderTimeout: time.Second}
+		p := policy
+		p.MaxAttempts = 2
+		err = <-RunHTTPServerWithContext(context.Background(), server, func() error {
+			starts.Add(1)
+			return server.ListenAndServe()
+		}, WithHTTPRestart(p), WithHTTPLogger(slog.New(slog.NewTextHandler(logs, nil))))
+		require.ErrorIs(t, err, syscall.EADDRINUSE)
+		assert.Equal(t, int32(3), starts.Load(), "the first start and two restarts")
+		assert.Contains(t, logs.String(), "giving up")
+	})
+
+	t.Run("failure not retryable", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		var starts atomic.Int32
+		err := <-RunHTTPServerWithContext(context.Background(), &http.Server{}, func() error {
+			starts.Add(1)
+			return errBoom
+		}, WithHTTPRestart(policy), WithHTTPLogger(slog.New(slog.NewTextHandler(&lockedBuffer{}, nil))))
+		require.ErrorIs(t, err, errBoom)
+		assert.Equal(t, int32(1), starts.Load())
+	})
+}
@@ -0,0 +1,82 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Stages reported by ServerError.
+const (
+	StageServe    = "serve"    // the server failed while starting or serving
+	StageShutdown = "shutdown" // the graceful shutdown of the server failed
+)
+
+// HTTPServerSpec describes a server run by RunHTTPServers.
+type HTTPServerSpec struct {
+	Name    string       // identifies the server in errors and logs, the server address if empty
+	Server  *http.Server // the server to run
+	StartFn func() error // starts the server, Server.ListenAndServe if nil
+	Options []HTTPOption // options of the server run, as for RunHTTPServerWithContext
+}
+
+// ServerError is an error of one of the servers run by RunHTTPServers.
+type ServerError struct {
+	Name  string // the name of the server
+	Stage string // StageServe or StageShutdown
+	Err   error
+}
+
+// Error returns the error prefixed by the server name and the stage.
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server %s: %s: %v", e.Name, e.Stage, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// RunHTTPServers runs several HTTP servers as one unit, e.g. an API and an admin server. All of them
+// are shut down, concurrently and each with its own shutdown timeout, when the context is canceled or
+// when any one of them stops on its own. It returns once every server stopped, with the errors of all
+// servers joined, each a *ServerError naming the server and the stage it failed at.
+func RunHTTPServers(ctx context.Context, servers ...HTTPServerSpec) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type named struct {
+		name string
+		res  httpResult
+	}
+	results := make(chan named, len(servers))
+	for _, spec := range servers {
+		name := spec.Name
+		if name == "" {
+			name = spec.Server.Addr
+		}
+		startFn := spec.StartFn
+		if startFn == nil {
+			startFn = spec.Server.ListenAndServe
+		}
+		resCh := runHTTPServer(runCtx, spec.Server, startFn, spec.Options...)
+		go func() { results <- named{name: name, res: <-resCh} }()
+	}
+
+	var errs []error
+	for range servers {
+		r := <-results
+		if r.res.self {
+			// one server is gone, the others are stopped rather than left serving half of the process
+			cancel()
+		}
+		if r.res.serve != nil {
+			errs = append(errs, &ServerError{Name: r.name, Stage: StageServe, Err: r.res.serve})
+		}
+		if r.res.shutdown != nil {
+			errs = append(errs, &ServerError{Name: r.name, Stage: StageShutdown, Err: r.res.shutdown})
+		}
+	}
+	return errors.Join(errs...)
+}
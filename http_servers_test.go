@@ -0,0 +1,112 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHTTPServers(t *testing.T) {
+	discard := WithHTTPLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// serverOn returns a spec of a server serving on a fresh listener
+	serverOn := func(t *testing.T, name string, handler http.Handler, opts ...HTTPOption) (HTTPServerSpec, string) {
+		t.Helper()
+		listener, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		server := &http.Server{Handler: handler}
+		return HTTPServerSpec{Name: name, Server: server, StartFn: func() error { return server.Serve(listener) },
+			Options: append([]HTTPOption{discard}, opts...)}, listener.Addr().String()
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	client := &http.Client{Timeout: 30 * time.Second} // bound so a stuck server fails the test
+
+	t.Run("all servers stop on cancellation", func(t *testing.T) {
+		api, apiAddr := serverOn(t, "api", ok)
+		admin, adminAddr := serverOn(t, "admin", ok)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- RunHTTPServers(ctx, api, admin) }()
+
+		for _, addr := range []string{apiAddr, adminAddr} {
+			resp, err := client.Get("http://" + addr)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	t.Run("failing server stops the others", func(t *testing.T) {
+		api, apiAddr := serverOn(t, "api", ok)
+
+		busy, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		defer busy.Close()
+		// without a name the address identifies the server, without a start function it listens on it
+		admin := HTTPServerSpec{Server: &http.Server{Addr: busy.Addr().String()}, Options: []HTTPOption{discard}}
+
+		err = RunHTTPServers(context.Background(), api, admin)
+		require.Error(t, err)
+
+		var serverErr *ServerError
+		require.ErrorAs(t, err, &serverErr)
+		assert.Equal(t, busy.Addr().String(), serverErr.Name)
+		assert.Equal(t, StageServe, serverErr.Stage)
+		assert.Contains(t, err.Error(), "server "+busy.Addr().String()+": serve: listen tcp")
+
+		_, err = client.Get("http://" + apiAddr)
+		require.Error(t, err, "the healthy server is shut down too")
+	})
+
+	t.Run("shutdown stage reported", func(t *testing.T) {
+		handlerStarted, releaseHandler := make(chan struct{}), make(chan struct{})
+		defer close(releaseHandler)
+		slow, slowAddr := serverOn(t, "slow", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			close(handlerStarted)
+			<-releaseHandler
+		}), WithHTTPShutdownTimeout(50*time.Millisecond))
+		fast, _ := serverOn(t, "fast", ok)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- RunHTTPServers(ctx, slow, fast) }()
+
+		go func() {
+			if resp, err := client.Get("http://" + slowAddr); err == nil {
+				resp.Body.Close()
+			}
+		}()
+		<-handlerStarted
+
+		cancel()
+		err := <-done
+		require.Error(t, err)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		var serverErr *ServerError
+		require.ErrorAs(t, err, &serverErr)
+		assert.Equal(t, &ServerError{Name: "slow", Stage: StageShutdown, Err: serverErr.Err}, serverErr)
+		assert.Len(t, unwrapJoined(err), 1, "only the slow server failed")
+	})
+}
+
+// unwrapJoined returns the errors joined by errors.Join
+func unwrapJoined(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -0,0 +1,71 @@
+package ctrl
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// WithHTTPLoadShedding makes the server reject the requests coming in once it started draining with
+// 503 Service Unavailable and a Retry-After header, while the requests already in progress finish.
+// Requests still reaching the server over pooled connections or through a load balancer slow to
+// deregister it are sent elsewhere rather than keeping the shutdown busy. Paths in allow keep being
+// served, e.g. health checks and metrics; an entry ending with "/" allows the paths under it. The
+// number of shed requests is logged once the server stopped.
+func WithHTTPLoadShedding(retryAfter time.Duration, allow ...string) HTTPOption {
+	return func(o *httpOptions) {
+		o.shedding = true
+		o.shedRetryAfter = retryAfter
+		o.shedAllow = allow
+	}
+}
+
+// loadShedder rejects the requests not allowed once the server is draining.
+type loadShedder struct {
+	draining   <-chan struct{}
+	retryAfter string // in seconds, as sent in the header
+	allow      []string
+	shed       atomic.Int64
+}
+
+func newLoadShedder(draining <-chan struct{}, retryAfter time.Duration, allow []string) *loadShedder {
+	secs := max(int64(math.Ceil(retryAfter.Seconds())), 1)
+	return &loadShedder{draining: draining, retryAfter: strconv.FormatInt(secs, 10), allow: allow}
+}
+
+// install wraps the handler of the server, the returned function restores it.
+func (s *loadShedder) install(server *http.Server) (restore func()) {
+	prev := server.Handler
+	handler := prev
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-s.draining:
+			if !s.allowed(r.URL.Path) {
+				s.shed.Add(1)
+				w.Header().Set("Retry-After", s.retryAfter)
+				w.Header().Set("Connection", "close")
+				http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+				return
+			}
+		default:
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return func() { server.Handler = prev }
+}
+
+// allowed reports whether the path keeps being served while draining.
+func (s *loadShedder) allowed(path string) bool {
+	for _, a := range s.allow {
+		if path == a || (strings.HasSuffix(a, "/") && strings.HasPrefix(path, a)) {
+			return true
+		}
+	}
+	return false
+}
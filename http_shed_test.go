@@ -0,0 +1,69 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPLoadShedding(t *testing.T) {
+	inFlight, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		close(inFlight)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	logs := &lockedBuffer{}
+	server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second, Handler: mux}
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := StartHTTPServer(ctx, server, WithHTTPLogger(slog.New(slog.NewTextHandler(logs, nil))),
+		WithHTTPDrainPeriod(time.Second), WithHTTPLoadShedding(1500*time.Millisecond, "/health", "/metrics/"))
+	require.NoError(t, err)
+	url := "http://" + h.Addr().String()
+	client := &http.Client{Timeout: waitLimit}
+
+	get := func(path string) *http.Response {
+		resp, err := client.Get(url + path)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+	assert.Equal(t, http.StatusOK, get("/api").StatusCode, "served before the drain")
+
+	slowStatus := make(chan int, 1)
+	go func() {
+		resp, err := client.Get(url + "/slow")
+		if err != nil {
+			slowStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		slowStatus <- resp.StatusCode
+	}()
+	<-inFlight
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	resp := get("/api")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "shed while draining")
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/healthz").StatusCode)
+	assert.Equal(t, http.StatusOK, get("/health").StatusCode, "allowed path")
+	assert.Equal(t, http.StatusOK, get("/metrics/requests").StatusCode, "allowed prefix")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-slowStatus, "the request in progress finishes")
+	require.NoError(t, <-h.Done())
+	assert.Contains(t, logs.String(), "requests shed while draining")
+	assert.Contains(t, logs.String(), "count=2")
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -15,6 +17,30 @@ type HTTPOption func(*httpOptions)
 type httpOptions struct {
 	shutdownTimeout time.Duration
 	logger          *slog.Logger
+	idleTimeout     time.Duration
+	hijackTracking  bool
+	drainPeriod     time.Duration
+	forceCloseGrace time.Duration
+	onShutdown      []func(ctx context.Context) error
+	timeoutCheck    bool
+	timeoutStrict   bool
+	restart         *RestartPolicy
+	drainProgress   time.Duration
+
+	socketMode fs.FileMode
+	socketUID  int
+	socketGID  int
+
+	shedding       bool
+	shedRetryAfter time.Duration
+	shedAllow      []string
+
+	clientCAFile       string
+	certReloadSignal   os.Signal
+	certReloadInterval time.Duration
+
+	addr  string                                       // the address the server is registered with, server.Addr if empty
+	hooks []func(server *http.Server) (restore func()) // installed on the server for the run
 }
 
 // WithHTTPShutdownTimeout sets the maximum time to wait for server shutdown.
@@ -31,6 +57,37 @@ func WithHTTPLogger(logger *slog.Logger) HTTPOption {
 	}
 }
 
+// newHTTPOptions applies the options of a server run over the defaults.
+func newHTTPOptions(opts []HTTPOption) httpOptions {
+	options := httpOptions{
+		shutdownTimeout: 10 * time.Second, // default timeout
+		logger:          slog.Default(),
+		socketUID:       -1,
+		socketGID:       -1,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// withHTTPHook installs a hook on the server for the run, undone with the returned function if the
+// server fails on its own.
+func withHTTPHook(hook func(server *http.Server) (restore func())) HTTPOption {
+	return func(o *httpOptions) {
+		o.hooks = append(o.hooks, hook)
+	}
+}
+
+// withHTTPAddr sets the address the server is registered with, for servers serving a listener of
+// their own rather than server.Addr.
+func withHTTPAddr(addr string) HTTPOption {
+	return func(o *httpOptions) {
+		o.addr = addr
+	}
+}
+
 // ShutdownHTTPServer gracefully shuts down an HTTP server with a timeout.
 // It returns any error encountered during shutdown.
 func ShutdownHTTPServer(ctx context.Context, server *http.Server, opts ...HTTPOption) error {
@@ -55,68 +112,191 @@ func ShutdownHTTPServer(ctx context.Context, server *http.Server, opts ...HTTPOp
 //
 // When the result is published depends on how the server stops. On context cancellation it comes
 // after the graceful shutdown drained the connections, so the caller may terminate the process at
-// that point; if the shutdown timeout expires first, the shutdown error is published as soon as the
-// timeout is reported, requests may well still be running, and startFn is not waited for, so a
-// serving error surfacing after that point is not reported. The error can be inspected with
-// errors.Is(err, context.DeadlineExceeded). A server that fails on its own reports right away and is
-// left untouched, so the caller can start it again. Connections that net/http does not wait for,
-// hijacked ones and those dropped by Server.Close among them, remain the caller's to track, as do
-// the callbacks of Server.RegisterOnShutdown, which Shutdown starts without awaiting them.
+// that point. If the shutdown timeout expires first, the shutdown error is published as soon as the
+// timeout is reported and can be inspected with errors.Is(err, context.DeadlineExceeded). Requests
+// may still be running then, and startFn is not waited for, so a serving error surfacing later is not
+// reported. A server that fails on its own reports right away and is left untouched, so the caller
+// can start it again.
+//
+// WithHTTPForceClose closes the server once the shutdown timeout expired and waits for startFn to
+// return. WithHTTPRestart starts a server failing on its own again instead of reporting the failure.
+// Hijacked connections, which net/http does not wait for, are the caller's to track unless
+// WithHTTPHijackTracking is set. Shutdown starts the callbacks of Server.RegisterOnShutdown without
+// awaiting them, while those registered with WithHTTPOnShutdown are awaited.
 func RunHTTPServerWithContext(ctx context.Context, server *http.Server, startFn func() error, opts ...HTTPOption) <-chan error {
-	options := httpOptions{
-		shutdownTimeout: 10 * time.Second, // default timeout
-		logger:          slog.Default(),
+	errCh := make(chan error, 1)
+	resCh := runHTTPServer(ctx, server, startFn, opts...)
+	go func() {
+		defer close(errCh)
+		errCh <- (<-resCh).err()
+	}()
+	return errCh
+}
+
+// httpResult is the outcome of a server run, the errors kept apart by the stage they come from.
+type httpResult struct {
+	serve    error // the start function failed
+	shutdown error // the graceful shutdown failed
+	self     bool  // the server stopped on its own, without a shutdown
+}
+
+// err returns the error reported to the caller of RunHTTPServerWithContext.
+func (r httpResult) err() error {
+	switch {
+	case r.serve != nil && r.shutdown != nil:
+		return errors.Join(r.serve, r.shutdown)
+	case r.serve != nil:
+		return r.serve
+	default:
+		return r.shutdown
 	}
+}
 
-	for _, opt := range opts {
-		opt(&options)
+// runHTTPServer implements RunHTTPServerWithContext, the returned channel delivers exactly one result.
+func runHTTPServer(ctx context.Context, server *http.Server, startFn func() error, opts ...HTTPOption) <-chan httpResult {
+	if options := newHTTPOptions(opts); options.restart != nil {
+		return restartHTTPServer(ctx, server, startFn, *options.restart, options.logger, opts)
 	}
+	return runHTTPServerOnce(ctx, server, startFn, opts...)
+}
+
+// runHTTPServerOnce runs the server a single time, the returned channel delivers exactly one result.
+func runHTTPServerOnce(ctx context.Context, server *http.Server, startFn func() error, opts ...HTTPOption) <-chan httpResult {
+	options := newHTTPOptions(opts)
 
 	// channel to report the final result to the caller
-	errCh := make(chan error, 1)
+	resCh := make(chan httpResult, 1)
+
+	if err := timeoutsError(server, options); err != nil {
+		resCh <- httpResult{serve: err, self: true}
+		return resCh
+	}
+
+	// the run gets a context of its own, so the server can stop without the caller's context ending
+	ctx, cancelRun := context.WithCancelCause(ctx)
+
+	// hooks installed on the server, undone if the server fails on its own so it can be started again
+	var restore []func()
+	for _, hook := range options.hooks {
+		restore = append(restore, hook(server))
+	}
+	drain := newDrainSignal()
+	restore = append(restore, drain.install(server))
+	go drain.watch(ctx)
+
+	var hijacked *hijackTracker
+	if options.hijackTracking {
+		hijacked = newHijackTracker(drain.ch)
+		restore = append(restore, hijacked.install(server))
+	}
+	var requests *requestCounter
+	if options.drainProgress > 0 {
+		// installed before the shedder, so shed requests are not counted
+		requests = &requestCounter{}
+		restore = append(restore, requests.install(server))
+	}
+	var shedder *loadShedder
+	if options.shedding {
+		shedder = newLoadShedder(drain.ch, options.shedRetryAfter, options.shedAllow)
+		restore = append(restore, shedder.install(server))
+	}
+	var tracker *connTracker
+	if options.idleTimeout > 0 || options.forceCloseGrace > 0 || options.drainProgress > 0 {
+		tracker = newConnTracker()
+		restore = append(restore, tracker.install(server))
+	}
+	if options.idleTimeout > 0 {
+		go watchIdle(ctx, tracker, options.idleTimeout, func(cause error) {
+			options.logger.Info("HTTP server idle, shutting down", "idle", options.idleTimeout)
+			if !TriggerShutdown(ctx, cause) {
+				cancelRun(cause)
+			}
+		})
+	}
 
 	// serveCh collects the result of startFn, always exactly one value
 	serveCh := make(chan error, 1)
 	go func() { serveCh <- startFn() }()
 
-	// single coordinator owning errCh, it publishes only after the server stopped
+	addr := options.addr
+	if addr == "" {
+		addr = server.Addr
+	}
+	unregister := registerServer(ctx, "http", addr)
+
+	// single coordinator owning resCh, it publishes only after the server stopped
 	go func() {
-		defer close(errCh)
+		defer cancelRun(nil)
+		defer unregister()
+
+		// the server gave up on its own, the caller learns why immediately and keeps the server
+		// intact, so a failed start can be retried on it
+		failed := func(err error) {
+			for _, fn := range restore {
+				fn()
+			}
+			resCh <- httpResult{serve: serveResult(err), self: true}
+		}
 
 		select {
 		case err := <-serveCh:
-			// the server gave up on its own, the caller learns why immediately and keeps the
-			// server intact, so a failed start can be retried on it
-			errCh <- serveResult(err)
+			failed(err)
 			return
 		case <-ctx.Done():
 			// both can be ready at once, and a server that already stopped is not shut down
 			select {
 			case err := <-serveCh:
-				errCh <- serveResult(err)
+				failed(err)
 				return
 			default:
 			}
 		}
 
 		options.logger.Info("shutting down HTTP server")
+		if options.drainPeriod > 0 {
+			options.logger.Info("draining HTTP server", "period", options.drainPeriod)
+		}
+		stopProgress := func() {}
+		if requests != nil {
+			stopProgress = startDrainProgress(tracker, requests, options.drainProgress, options.logger)
+		}
 
 		// the parent context is already canceled, so the shutdown gets its own deadline while
-		// keeping the context values
+		// keeping the context values; the deadline counts from the end of the drain period
+		drain.wait(options.drainPeriod)
 		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), options.shutdownTimeout)
 		defer cancel()
 
-		shutdownErr := server.Shutdown(shutdownCtx)
-		if shutdownErr != nil {
-			options.logger.Error("server shutdown error", "error", shutdownErr)
-			shutdownErr = fmt.Errorf("shutdown http server: %w", shutdownErr)
+		waitCallbacks := startCallbacks(shutdownCtx, options.onShutdown)
+		drainErr := server.Shutdown(shutdownCtx)
+		if hijacked != nil {
+			// Shutdown is done with the connections it knows, the hijacked ones get what is left of the timeout
+			if err := hijacked.wait(shutdownCtx); err != nil {
+				drainErr = errors.Join(drainErr, err)
+			}
+		}
+		// the callbacks failing says nothing about the server, only the drain running out of time does
+		callbacksErr := waitCallbacks()
+		timedOut := errors.Is(drainErr, context.DeadlineExceeded)
+		forced := timedOut && options.forceCloseGrace > 0
+		if forced {
+			drainErr = errors.Join(drainErr, forceClose(server, tracker, options.logger))
 		}
 
 		var serveErr error
-		if shutdownErr == nil {
+		switch {
+		case !timedOut:
 			// the drain is over, startFn returns as soon as the listeners are closed
 			serveErr = serveResult(<-serveCh)
-		} else {
+		case forced:
+			// the server is closed, startFn gets a bounded grace period to notice
+			select {
+			case err := <-serveCh:
+				serveErr = serveResult(err)
+			case <-time.After(options.forceCloseGrace):
+				options.logger.Warn("server start function did not return after close", "grace", options.forceCloseGrace)
+			}
+		default:
 			// the drain already gave up, waiting on startFn on top of that would defeat the timeout
 			select {
 			case err := <-serveCh:
@@ -125,17 +305,20 @@ func RunHTTPServerWithContext(ctx context.Context, server *http.Server, startFn
 			}
 		}
 
-		switch {
-		case serveErr != nil && shutdownErr != nil:
-			errCh <- errors.Join(serveErr, shutdownErr)
-		case serveErr != nil:
-			errCh <- serveErr
-		default:
-			errCh <- shutdownErr
+		shutdownErr := errors.Join(drainErr, callbacksErr)
+		if shutdownErr != nil {
+			options.logger.Error("server shutdown error", "error", shutdownErr)
+			shutdownErr = fmt.Errorf("shutdown http server: %w", shutdownErr)
 		}
+
+		stopProgress()
+		if shedder != nil {
+			options.logger.Info("requests shed while draining", "count", shedder.shed.Load())
+		}
+		resCh <- httpResult{serve: serveErr, shutdown: shutdownErr}
 	}()
 
-	return errCh
+	return resCh
 }
 
 // serveResult converts the result of the server start function to the value reported to the caller,
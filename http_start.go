@@ -0,0 +1,75 @@
+package ctrl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// HTTPServerHandle is a server started by StartHTTPServer.
+type HTTPServerHandle struct {
+	addr  net.Addr
+	ready chan struct{}
+	errCh <-chan error
+}
+
+// Addr returns the address the server is bound to, with the actual port if server.Addr asked for ":0".
+func (h *HTTPServerHandle) Addr() net.Addr {
+	return h.addr
+}
+
+// Ready returns a channel closed once the server accepts connections. It stays open if the server
+// stops before that.
+func (h *HTTPServerHandle) Ready() <-chan struct{} {
+	return h.ready
+}
+
+// Done returns the channel publishing the result of the run, as returned by RunHTTPServerWithContext.
+func (h *HTTPServerHandle) Done() <-chan error {
+	return h.errCh
+}
+
+// StartHTTPServer binds the listener of the server on server.Addr (":http" if empty) before anything
+// else, so a bind failure such as a port already in use is returned right away, and then serves it
+// with the same shutdown semantics as RunHTTPServerWithContext. The returned handle reports the bound
+// address, which is how the port picked for ":0" is learned, and when the server is accepting, the
+// moment to report readiness to systemd or Kubernetes or to start sending requests in tests.
+func StartHTTPServer(ctx context.Context, server *http.Server, opts ...HTTPOption) (*HTTPServerHandle, error) {
+	// checked before binding, a listener nobody serves would be left open otherwise
+	if err := timeoutsError(server, newHTTPOptions(opts)); err != nil {
+		return nil, err
+	}
+	addr := server.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	return serveListener(ctx, server, listener, opts), nil
+}
+
+// serveListener serves the bound listener with RunHTTPServerWithContext and returns its handle.
+func serveListener(ctx context.Context, server *http.Server, listener net.Listener, opts []HTTPOption) *HTTPServerHandle {
+	h := &HTTPServerHandle{addr: listener.Addr(), ready: make(chan struct{})}
+	// Serve asks for the base context once the listener is set up, right before accepting
+	markReady := func(server *http.Server) (restore func()) {
+		prev := server.BaseContext
+		var once sync.Once
+		server.BaseContext = func(l net.Listener) context.Context {
+			once.Do(func() { close(h.ready) })
+			if prev != nil {
+				return prev(l)
+			}
+			return context.Background()
+		}
+		return func() { server.BaseContext = prev }
+	}
+
+	opts = append(opts[:len(opts):len(opts)], withHTTPAddr(h.addr.String()), withHTTPHook(markReady), withoutTimeoutCheck())
+	h.errCh = RunHTTPServerWithContext(ctx, server, func() error { return server.Serve(listener) }, opts...)
+	return h
+}
@@ -0,0 +1,74 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartHTTPServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("binds synchronously and reports readiness", func(t *testing.T) {
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPLogger(logger))
+		require.NoError(t, err)
+
+		port := h.Addr().(*net.TCPAddr).Port
+		assert.NotZero(t, port, "the actual port is reported")
+
+		select {
+		case <-h.Ready():
+		case <-time.After(waitLimit):
+			t.Fatal("server not ready")
+		}
+		resp, err := http.Get("http://" + h.Addr().String())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+		cancel()
+		require.NoError(t, <-h.Done())
+	})
+
+	t.Run("bind failure returned right away", func(t *testing.T) {
+		l, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		defer l.Close()
+
+		server := &http.Server{Addr: l.Addr().String(), ReadHeaderTimeout: time.Second}
+		h, err := StartHTTPServer(context.Background(), server, WithHTTPLogger(logger))
+		require.Error(t, err)
+		assert.Nil(t, h)
+		assert.Contains(t, err.Error(), "listen on "+l.Addr().String())
+	})
+
+	t.Run("base context of the caller kept", func(t *testing.T) {
+		type key struct{}
+		got := make(chan any, 1)
+		server := &http.Server{Addr: "localhost:0", ReadHeaderTimeout: time.Second,
+			BaseContext: func(net.Listener) context.Context { return context.WithValue(context.Background(), key{}, "base") },
+			Handler:     http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { got <- r.Context().Value(key{}) })}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartHTTPServer(ctx, server, WithHTTPLogger(logger))
+		require.NoError(t, err)
+		<-h.Ready()
+
+		resp, err := http.Get("http://" + h.Addr().String())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "base", <-got)
+
+		cancel()
+		require.NoError(t, <-h.Done())
+	})
+}
@@ -0,0 +1,194 @@
+package ctrl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+)
+
+// WithHTTPClientCA makes RunHTTPSServerWithContext require client certificates signed by a CA from
+// the given PEM file (mutual TLS).
+func WithHTTPClientCA(caFile string) HTTPOption {
+	return func(o *httpOptions) {
+		o.clientCAFile = caFile
+	}
+}
+
+// WithHTTPCertReloadSignal makes RunHTTPSServerWithContext reload the certificate on the given signal,
+// e.g. syscall.SIGHUP.
+func WithHTTPCertReloadSignal(sig os.Signal) HTTPOption {
+	return func(o *httpOptions) {
+		o.certReloadSignal = sig
+	}
+}
+
+// WithHTTPCertReloadInterval makes RunHTTPSServerWithContext check the certificate and key files at
+// the given interval and reload them once their modification time changes.
+func WithHTTPCertReloadInterval(interval time.Duration) HTTPOption {
+	return func(o *httpOptions) {
+		o.certReloadInterval = interval
+	}
+}
+
+// RunHTTPSServerWithContext runs the server over TLS with the certificate and key from the given PEM
+// files, with the same result and shutdown semantics as RunHTTPServerWithContext. The certificate is
+// served through tls.Config.GetCertificate from an atomically swapped copy, so it can be reloaded
+// without a restart, on the signal set with WithHTTPCertReloadSignal or once the files change with
+// WithHTTPCertReloadInterval. A new pair that fails to load is logged and the old certificate kept.
+// A TLSConfig already set on the server is used as the base of the configuration.
+//
+// A certificate or client CA that can not be loaded at start is reported on the channel right away.
+func RunHTTPSServerWithContext(ctx context.Context, server *http.Server, certFile, keyFile string,
+	opts ...HTTPOption) <-chan error {
+	options := newHTTPOptions(opts)
+	errCh := make(chan error, 1)
+
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile, logger: options.logger}
+	tlsConfig, err := reloader.tlsConfig(server.TLSConfig, options.clientCAFile)
+	if err != nil {
+		errCh <- err
+		close(errCh)
+		return errCh
+	}
+	server.TLSConfig = tlsConfig
+
+	// the reload watch lives as long as the run, the signal is caught from the start as its default
+	// action may well terminate the process
+	var sigCh chan os.Signal
+	if options.certReloadSignal != nil {
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh, options.certReloadSignal)
+	}
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	go reloader.watch(watchCtx, sigCh, options.certReloadInterval)
+
+	resCh := runHTTPServer(ctx, server, func() error { return server.ListenAndServeTLS("", "") }, opts...)
+	go func() {
+		defer close(errCh)
+		defer cancelWatch()
+		if sigCh != nil {
+			defer signal.Stop(sigCh)
+		}
+		errCh <- (<-resCh).err()
+	}()
+	return errCh
+}
+
+// certReloader keeps the served certificate and reloads it from its files.
+type certReloader struct {
+	certFile, keyFile string
+	logger            *slog.Logger
+
+	cert    atomic.Pointer[tls.Certificate]
+	modTime time.Time // the modification time of the files loaded at start
+}
+
+// tlsConfig loads the certificate and the client CA and returns the configuration serving them.
+func (r *certReloader) tlsConfig(base *tls.Config, clientCAFile string) (*tls.Config, error) {
+	modTime, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.modTime = modTime
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	cfg.Certificates = nil
+	cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return r.cert.Load(), nil }
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile) //nolint:gosec // the path is the caller's configuration
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in client CA %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// load reads the certificate pair and swaps it in, the certificate served so far stays on failure.
+// It returns the modification time of the files.
+func (r *certReloader) load() (time.Time, error) {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("load certificate: %w", err)
+	}
+	r.cert.Store(&cert)
+	return modTime, nil
+}
+
+// filesModTime returns the latest modification time of the certificate and key files.
+func (r *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("load certificate: %w", err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// watch reloads the certificate on a signal and on a change of the files until the context ends.
+// Either trigger is off if nil or zero.
+func (r *certReloader) watch(ctx context.Context, sigCh <-chan os.Signal, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// a pair failing to load is not retried until the files change again, so it is logged once
+	seen := r.modTime
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			r.reload("signal")
+		case <-tick:
+			modTime, err := r.filesModTime()
+			if errors.Is(err, os.ErrNotExist) {
+				// the files are being replaced, the next tick sees the new ones
+				continue
+			}
+			if err == nil && modTime.Equal(seen) {
+				continue
+			}
+			seen = modTime
+			r.reload("files changed")
+		}
+	}
+}
+
+// reload loads the certificate pair again and logs the outcome.
+func (r *certReloader) reload(reason string) {
+	if _, err := r.load(); err != nil {
+		r.logger.Error("certificate reload failed, keeping the current one", "reason", reason, "error", err)
+		return
+	}
+	r.logger.Info("certificate reloaded", "reason", reason, "cert", r.certFile)
+}
@@ -0,0 +1,192 @@
+package ctrl
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for localhost with the given serial number and its key,
+// usable by servers and clients and as its own CA
+func writeCert(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+// servedSerial connects to the address and returns the serial number of the served certificate,
+// retrying while the server is not listening yet
+func servedSerial(t *testing.T, addr string, clientCerts ...tls.Certificate) int64 {
+	t.Helper()
+	deadline := time.Now().Add(waitLimit)
+	for {
+		dialer := &net.Dialer{Timeout: time.Second}
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true, Certificates: clientCerts})
+		if err == nil {
+			defer conn.Close()
+			return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("can't connect to %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// awaitSerial waits until the server serves the certificate with the given serial number
+func awaitSerial(t *testing.T, addr string, serial int64) {
+	t.Helper()
+	deadline := time.Now().Add(waitLimit)
+	for servedSerial(t, addr) != serial {
+		if time.Now().After(deadline) {
+			t.Fatalf("certificate %d not served", serial)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunHTTPSServerWithContext(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	t.Run("reload on file change, invalid pair keeps the current one", func(t *testing.T) {
+		writeCert(t, certFile, keyFile, 1)
+		server := &http.Server{Addr: freeAddr(t), Handler: ok}
+		logs := &lockedBuffer{}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunHTTPSServerWithContext(ctx, server, certFile, keyFile,
+			WithHTTPCertReloadInterval(10*time.Millisecond),
+			WithHTTPLogger(slog.New(slog.NewTextHandler(logs, nil))),
+		)
+		assert.Equal(t, int64(1), servedSerial(t, server.Addr))
+
+		client := &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		resp, err := client.Get("https://" + server.Addr)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// the modification time is moved on, file systems with a coarse clock may not see the rewrite
+		writeCert(t, certFile, keyFile, 2)
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(certFile, future, future))
+		awaitSerial(t, server.Addr, 2)
+		assert.Contains(t, logs.String(), "certificate reloaded")
+
+		require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0o600))
+		future = future.Add(time.Minute)
+		require.NoError(t, os.Chtimes(keyFile, future, future))
+		require.Eventually(t, func() bool { return strings.Contains(logs.String(), "certificate reload failed") },
+			waitLimit, 10*time.Millisecond)
+		assert.Equal(t, int64(2), servedSerial(t, server.Addr))
+
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("reload on signal", func(t *testing.T) {
+		writeCert(t, certFile, keyFile, 3)
+		server := &http.Server{Addr: freeAddr(t), Handler: ok}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunHTTPSServerWithContext(ctx, server, certFile, keyFile,
+			WithHTTPCertReloadSignal(syscall.SIGHUP),
+			WithHTTPLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		)
+		assert.Equal(t, int64(3), servedSerial(t, server.Addr))
+
+		writeCert(t, certFile, keyFile, 4)
+		process, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err)
+		require.NoError(t, process.Signal(syscall.SIGHUP))
+		awaitSerial(t, server.Addr, 4)
+
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("client certificates required with a client CA", func(t *testing.T) {
+		writeCert(t, certFile, keyFile, 5)
+		clientCert, clientKey := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+		writeCert(t, clientCert, clientKey, 6)
+		server := &http.Server{Addr: freeAddr(t), Handler: ok}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunHTTPSServerWithContext(ctx, server, certFile, keyFile,
+			WithHTTPClientCA(clientCert),
+			WithHTTPLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		)
+
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), servedSerial(t, server.Addr, cert))
+
+		client := &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		_, err = client.Get("https://" + server.Addr)
+		require.Error(t, err, "a client without a certificate is refused")
+
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("certificate that can not be loaded", func(t *testing.T) {
+		server := &http.Server{Addr: freeAddr(t)}
+		err := <-RunHTTPSServerWithContext(context.Background(), server, filepath.Join(dir, "missing.pem"), keyFile)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "load certificate")
+
+		writeCert(t, certFile, keyFile, 7)
+		err = <-RunHTTPSServerWithContext(context.Background(), server, certFile, keyFile, WithHTTPClientCA(keyFile))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no certificates in client CA")
+	})
+}
@@ -0,0 +1,121 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// WithHTTPSocketMode sets the permissions of the socket file created by StartUnixHTTPServer, set before
+// anyone else can connect. By default the file gets the mode the umask gives.
+func WithHTTPSocketMode(mode fs.FileMode) HTTPOption {
+	return func(o *httpOptions) {
+		o.socketMode = mode
+	}
+}
+
+// WithHTTPSocketOwner sets the owner and group of the socket file created by StartUnixHTTPServer,
+// -1 keeps either unchanged.
+func WithHTTPSocketOwner(uid, gid int) HTTPOption {
+	return func(o *httpOptions) {
+		o.socketUID, o.socketGID = uid, gid
+	}
+}
+
+// StartUnixHTTPServer is StartHTTPServer serving on a unix domain socket at the given path instead of
+// server.Addr. A socket file left by a previous run is removed if nothing listens on it any more; a
+// socket still in use or a file that is not a socket is an error. The socket file gets the mode and
+// owner set with WithHTTPSocketMode and WithHTTPSocketOwner, and is removed once the server stopped,
+// before the result is published, as well as on a forced exit of GracefulShutdown if the context
+// comes from it.
+func StartUnixHTTPServer(ctx context.Context, server *http.Server, path string, opts ...HTTPOption) (*HTTPServerHandle, error) {
+	options := newHTTPOptions(opts)
+	if err := timeoutsError(server, options); err != nil {
+		return nil, err
+	}
+	listener, err := listenUnix(path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// the forced exit skips the end of the run, the socket is removed as the process enters it
+	unsubscribe := func() {}
+	if c := controlFrom(ctx); c != nil {
+		unsubscribe = c.lifecycle.Subscribe(func(_, to State) {
+			if to == StateForceExiting {
+				removeSocket(path, options.logger)
+			}
+		})
+	}
+
+	h := serveListener(ctx, server, listener, opts)
+	resCh := h.errCh
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		err := <-resCh
+		unsubscribe()
+		removeSocket(path, options.logger)
+		errCh <- err
+	}()
+	h.errCh = errCh
+	return h, nil
+}
+
+// listenUnix listens on the socket path, removing a stale socket file, and sets the file mode and owner.
+func listenUnix(path string, options httpOptions) (net.Listener, error) {
+	if err := removeStaleSocket(path, options.logger); err != nil {
+		return nil, err
+	}
+
+	listener, err := listenSocket(path, options.socketMode)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", path, err)
+	}
+	if options.socketUID >= 0 || options.socketGID >= 0 {
+		if err := os.Chown(path, options.socketUID, options.socketGID); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("set socket owner: %w", err)
+		}
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket file at the path left by a process that is gone, found by
+// nothing listening on it. A socket still in use and a file that is not a socket are errors.
+func removeStaleSocket(path string, logger *slog.Logger) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	if fi.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("check socket %s: %w", path, err)
+	}
+	logger.Info("removing stale socket", "path", path)
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// removeSocket removes the socket file, which the listener may well have removed already.
+func removeSocket(path string, logger *slog.Logger) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Warn("can't remove socket", "path", path, "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartUnixHTTPServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	// unixClient sends requests over the socket at the path
+	unixClient := func(path string) *http.Client {
+		return &http.Client{Timeout: waitLimit, Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			}}}
+	}
+
+	t.Run("serves on the socket and removes it", func(t *testing.T) {
+		path := socketPath(t)
+		server := &http.Server{ReadHeaderTimeout: time.Second, Handler: ok}
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartUnixHTTPServer(ctx, server, path, WithHTTPLogger(logger), WithHTTPSocketMode(0o600))
+		require.NoError(t, err)
+		assert.Equal(t, path, h.Addr().String())
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0o600), fi.Mode().Perm())
+
+		<-h.Ready()
+		resp, err := unixClient(path).Get("http://unix/")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		cancel()
+		require.NoError(t, <-h.Done())
+		_, err = os.Stat(path)
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("stale socket replaced, live one and other files kept", func(t *testing.T) {
+		path := socketPath(t)
+		stale, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := StartUnixHTTPServer(ctx, &http.Server{ReadHeaderTimeout: time.Second, Handler: ok}, path,
+			WithHTTPLogger(logger))
+		require.NoError(t, err, "nothing listens on the stale socket")
+
+		_, err = StartUnixHTTPServer(context.Background(), &http.Server{ReadHeaderTimeout: time.Second}, path,
+			WithHTTPLogger(logger))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is in use")
+		cancel()
+		require.NoError(t, <-h.Done())
+
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+		_, err = StartUnixHTTPServer(context.Background(), &http.Server{ReadHeaderTimeout: time.Second}, path,
+			WithHTTPLogger(logger))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is not a socket")
+	})
+
+	t.Run("socket removed on forced exit", func(t *testing.T) {
+		path := socketPath(t)
+		exitCalls := make(chan int, 1)
+		ctx, cancel := GracefulShutdown(WithTimeout(100*time.Millisecond), WithLogger(logger),
+			withOsExit(func(code int) { exitCalls <- code }))
+		defer cancel()
+
+		started, release := make(chan struct{}), make(chan struct{})
+		defer close(release)
+		server := &http.Server{ReadHeaderTimeout: time.Second, Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			close(started)
+			<-release
+		})}
+		h, err := StartUnixHTTPServer(ctx, server, path, WithHTTPLogger(logger), WithHTTPShutdownTimeout(time.Hour))
+		require.NoError(t, err)
+		go func() {
+			if resp, err := unixClient(path).Get("http://unix/"); err == nil {
+				resp.Body.Close()
+			}
+		}()
+		<-started
+
+		require.True(t, TriggerShutdown(ctx, context.Canceled))
+		select {
+		case <-exitCalls:
+		case <-time.After(waitLimit):
+			t.Fatal("no forced exit")
+		}
+		_, err = os.Stat(path)
+		require.ErrorIs(t, err, fs.ErrNotExist, "removed while the server still drains")
+		select {
+		case <-h.Done():
+			t.Fatal("the server was not draining")
+		default:
+		}
+	})
+}
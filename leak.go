@@ -0,0 +1,130 @@
+package ctrl
+
+import (
+	"bytes"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// goroutineInfo is a goroutine parsed from a runtime.Stack dump.
+type goroutineInfo struct {
+	id        int
+	createdBy string // creation site, the function and its location without the pc offset
+	stack     string // the whole record as printed by the runtime
+}
+
+// leakReport compares the goroutines running after the shutdown with those running when it was set up.
+type leakReport struct {
+	baseline map[int]bool
+	settle   time.Duration
+	logger   *slog.Logger
+}
+
+// newLeakReport captures the baseline, every goroutine running at this point is considered expected.
+func newLeakReport(settle time.Duration, logger *slog.Logger) *leakReport {
+	baseline := map[int]bool{}
+	for _, g := range parseGoroutines(goroutineDump(true)) {
+		baseline[g.id] = true
+	}
+	return &leakReport{baseline: baseline, settle: settle, logger: logger}
+}
+
+// run logs the goroutines started after the baseline and still running, grouped by creation stack.
+// Goroutines still winding down get up to the settle period to exit before they count as leaked.
+func (r *leakReport) run() {
+	leaked := r.leaked()
+	for deadline := time.Now().Add(r.settle); len(leaked) > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		leaked = r.leaked()
+	}
+
+	if len(leaked) == 0 {
+		r.logger.Info("no goroutines leaked after shutdown")
+		return
+	}
+
+	groups := map[string][]goroutineInfo{}
+	for _, g := range leaked {
+		groups[g.createdBy] = append(groups[g.createdBy], g)
+	}
+	sites := make([]string, 0, len(groups))
+	for site := range groups {
+		sites = append(sites, site)
+	}
+	// the largest group first, it is the most likely culprit
+	slices.SortFunc(sites, func(a, b string) int {
+		if n := len(groups[b]) - len(groups[a]); n != 0 {
+			return n
+		}
+		return strings.Compare(a, b)
+	})
+
+	r.logger.Warn("goroutines leaked after shutdown", "count", len(leaked), "groups", len(groups))
+	for _, site := range sites {
+		r.logger.Warn("leaked goroutines", "count", len(groups[site]), "created_by", site, "example", groups[site][0].stack)
+	}
+}
+
+// leaked returns the goroutines not in the baseline, except the calling one.
+func (r *leakReport) leaked() []goroutineInfo {
+	self := parseGoroutines(goroutineDump(false))
+	var res []goroutineInfo
+	for _, g := range parseGoroutines(goroutineDump(true)) {
+		if r.baseline[g.id] || (len(self) == 1 && g.id == self[0].id) {
+			continue
+		}
+		res = append(res, g)
+	}
+	return res
+}
+
+// goroutineDump returns the stacks of all goroutines or of the calling one only.
+func goroutineDump(all bool) []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, all)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// parseGoroutines splits a runtime.Stack dump into goroutines. Records it cannot parse are skipped.
+func parseGoroutines(dump []byte) []goroutineInfo {
+	var res []goroutineInfo
+	for _, rec := range bytes.Split(dump, []byte("\n\n")) {
+		rec = bytes.TrimSpace(rec)
+		header, rest, _ := bytes.Cut(rec, []byte("\n"))
+		// the header reads "goroutine 42 [chan receive]:"
+		fields := strings.Fields(string(header))
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		id, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		res = append(res, goroutineInfo{id: id, createdBy: creationSite(string(rest)), stack: string(rec)})
+	}
+	return res
+}
+
+// creationSite extracts the "created by" frame of a goroutine stack, which is the same for every
+// goroutine started by the same go statement. The goroutine id of the creator and the pc offset are
+// dropped, they differ between goroutines of the same site.
+func creationSite(stack string) string {
+	_, after, found := strings.Cut(stack, "created by ")
+	if !found {
+		return "unknown"
+	}
+	fn, loc, _ := strings.Cut(after, "\n")
+	fn, _, _ = strings.Cut(fn, " in goroutine ")
+	loc, _, _ = strings.Cut(strings.TrimSpace(loc), "\n")
+	loc, _, _ = strings.Cut(loc, " +0x")
+	return fn + " at " + loc
+}
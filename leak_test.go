@@ -0,0 +1,109 @@
+package ctrl
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGoroutines(t *testing.T) {
+	dump := `goroutine 1 [running]:
+main.main()
+	/app/main.go:10 +0x1d
+
+goroutine 42 [chan receive]:
+example.com/app.worker(0xc000010000)
+	/app/worker.go:20 +0x25
+created by example.com/app.start in goroutine 1
+	/app/worker.go:12 +0x4f
+
+goroutine 43 [chan receive]:
+example.com/app.worker(0xc000010008)
+	/app/worker.go:20 +0x25
+created by example.com/app.start in goroutine 7
+	/app/worker.go:12 +0x4f
+
+not a goroutine record
+`
+	gs := parseGoroutines([]byte(dump))
+	require.Len(t, gs, 3)
+	assert.Equal(t, 1, gs[0].id)
+	assert.Equal(t, "unknown", gs[0].createdBy)
+	assert.Equal(t, 42, gs[1].id)
+	assert.Equal(t, "example.com/app.start at /app/worker.go:12", gs[1].createdBy)
+	assert.Equal(t, gs[1].createdBy, gs[2].createdBy, "goroutines of the same go statement share the site")
+	assert.True(t, strings.HasPrefix(gs[2].stack, "goroutine 43 [chan receive]:"))
+}
+
+// leakyWorker blocks until released, standing for a worker ignoring the shutdown context
+func leakyWorker(release <-chan struct{}) { <-release }
+
+func TestLeakReport(t *testing.T) {
+	t.Run("leaked goroutines grouped by creation site", func(t *testing.T) {
+		var buf bytes.Buffer
+		lc := NewLifecycle()
+		_, cancel := GracefulShutdown(
+			WithLifecycle(lc),
+			WithLeakReport(50*time.Millisecond),
+			WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+			WithoutForceExit(),
+		)
+
+		release := make(chan struct{})
+		defer close(release)
+		for range 3 {
+			go leakyWorker(release)
+		}
+
+		cancel()
+		require.NoError(t, lc.Transition(StateStopped))
+
+		out := buf.String()
+		assert.Contains(t, out, "goroutines leaked after shutdown")
+		assert.Contains(t, out, "count=3 created_by=")
+		assert.Contains(t, out, "leak_test.go")
+		assert.Contains(t, out, "ctrl.leakyWorker")
+	})
+
+	t.Run("goroutines exiting within the settle period are not reported", func(t *testing.T) {
+		var buf bytes.Buffer
+		lc := NewLifecycle()
+		_, cancel := GracefulShutdown(
+			WithLifecycle(lc),
+			WithLeakReport(5*time.Second),
+			WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+			WithoutForceExit(),
+		)
+
+		release := make(chan struct{})
+		go leakyWorker(release)
+		time.AfterFunc(50*time.Millisecond, func() { close(release) })
+
+		cancel()
+		require.NoError(t, lc.Transition(StateStopped))
+		assert.Contains(t, buf.String(), "no goroutines leaked after shutdown")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		var buf bytes.Buffer
+		lc := NewLifecycle()
+		_, cancel := GracefulShutdown(WithLifecycle(lc), WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+			WithoutForceExit())
+
+		cancel()
+		require.NoError(t, lc.Transition(StateStopped))
+		assert.NotContains(t, buf.String(), "leaked")
+	})
+	t.Run("warns without a lifecycle", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, cancel := GracefulShutdown(WithLeakReport(time.Second),
+			WithLogger(slog.New(slog.NewTextHandler(&buf, nil))), WithoutForceExit())
+		cancel()
+		assert.Contains(t, buf.String(), "leak report disabled, it needs a lifecycle set with WithLifecycle")
+	})
+}
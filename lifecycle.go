@@ -0,0 +1,151 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// State is a stage of the process lifecycle tracked by Lifecycle.
+type State int
+
+// Lifecycle states, in the order a process normally goes through them.
+const (
+	StateStarting     State = iota // the process is initializing, nothing is served yet
+	StateReady                     // the process serves traffic
+	StateDraining                  // shutdown began, the process stops taking new work, e.g. leaves the load balancer
+	StateStopping                  // components stop, the context returned by GracefulShutdown is canceled
+	StateStopped                   // the graceful shutdown completed
+	StateForceExiting              // the graceful shutdown gave up and the process is about to exit
+)
+
+// ErrInvalidTransition is returned by Lifecycle.Transition for a move the state machine does not allow.
+var ErrInvalidTransition = errors.New("invalid lifecycle transition")
+
+// String returns the lower-case name of the state.
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateReady:
+		return "ready"
+	case StateDraining:
+		return "draining"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	case StateForceExiting:
+		return "force-exiting"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+// Lifecycle is an explicit process state machine. It starts in StateStarting, only moves along valid
+// transitions and lets components react to the stage they care about, either through the per-state
+// contexts or by subscribing to transitions. GracefulShutdown drives it through Draining, Stopping and
+// ForceExiting when configured with WithLifecycle, while Ready and Stopped are reported by the caller,
+// which alone knows when the process serves and when everything has finished.
+type Lifecycle struct {
+	transitionMu sync.Mutex // serializes transitions, so subscribers observe them in order
+
+	mu      sync.Mutex
+	state   State
+	subs    []subscription
+	nextSub int
+
+	ctxs    [StateForceExiting + 1]context.Context
+	cancels [StateForceExiting + 1]context.CancelFunc
+}
+
+// subscription is a transition callback registered with Lifecycle.Subscribe.
+type subscription struct {
+	id int
+	fn func(from, to State)
+}
+
+// NewLifecycle makes a lifecycle in StateStarting.
+func NewLifecycle() *Lifecycle {
+	l := &Lifecycle{state: StateStarting}
+	for s := range l.ctxs {
+		l.ctxs[s], l.cancels[s] = context.WithCancel(context.Background())
+	}
+	l.cancels[StateStarting]()
+	return l
+}
+
+// State returns the current state.
+func (l *Lifecycle) State() State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// Context returns a context canceled once the lifecycle enters the given state or any state past it,
+// so a component bound to Draining is released even if the process goes straight to Stopping.
+// ForceExiting counts as past every other state.
+func (l *Lifecycle) Context(s State) context.Context {
+	if s < StateStarting || s > StateForceExiting {
+		panic(fmt.Sprintf("ctrl: unknown lifecycle state %d", int(s)))
+	}
+	return l.ctxs[s]
+}
+
+// Subscribe registers a function called on every transition with the previous and the new state.
+// Subscribers are called synchronously and in order of subscription, after the state changed and
+// the per-state contexts were canceled; they must not call Transition. The returned function
+// removes the subscription.
+func (l *Lifecycle) Subscribe(fn func(from, to State)) (unsubscribe func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id := l.nextSub
+	l.nextSub++
+	l.subs = append(l.subs, subscription{id: id, fn: fn})
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.subs = slices.DeleteFunc(l.subs, func(s subscription) bool { return s.id == id })
+	}
+}
+
+// Transition moves the lifecycle to the given state. It returns an error wrapping ErrInvalidTransition
+// if the move is not allowed from the current state, leaving the state unchanged.
+func (l *Lifecycle) Transition(to State) error {
+	l.transitionMu.Lock()
+	defer l.transitionMu.Unlock()
+
+	l.mu.Lock()
+	from := l.state
+	if !canTransition(from, to) {
+		l.mu.Unlock()
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+	l.state = to
+	for s := StateStarting; s <= to; s++ {
+		l.cancels[s]()
+	}
+	subs := slices.Clone(l.subs)
+	l.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.fn(from, to)
+	}
+	return nil
+}
+
+// canTransition reports whether the lifecycle may move between the states. It only moves forward and
+// may skip states, except that Stopped is reached only through Stopping, and nothing leaves Stopped
+// or ForceExiting.
+func canTransition(from, to State) bool {
+	switch {
+	case from == StateStopped || from == StateForceExiting:
+		return false
+	case to == StateStopped:
+		return from == StateStopping
+	default:
+		return to > from && to <= StateForceExiting
+	}
+}
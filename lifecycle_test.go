@@ -0,0 +1,73 @@
+package ctrl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycle(t *testing.T) {
+	t.Run("normal path", func(t *testing.T) {
+		lc := NewLifecycle()
+		assert.Equal(t, StateStarting, lc.State())
+
+		for _, s := range []State{StateReady, StateDraining, StateStopping, StateStopped} {
+			require.NoError(t, lc.Transition(s))
+			assert.Equal(t, s, lc.State())
+		}
+	})
+
+	t.Run("invalid transitions rejected", func(t *testing.T) {
+		lc := NewLifecycle()
+		require.NoError(t, lc.Transition(StateReady))
+
+		err := lc.Transition(StateStarting)
+		require.ErrorIs(t, err, ErrInvalidTransition)
+		assert.Equal(t, "invalid lifecycle transition: ready to starting", err.Error())
+		require.ErrorIs(t, lc.Transition(StateReady), ErrInvalidTransition, "a state is not re-entered")
+		require.ErrorIs(t, lc.Transition(StateStopped), ErrInvalidTransition, "stopped only follows stopping")
+		assert.Equal(t, StateReady, lc.State())
+
+		require.NoError(t, lc.Transition(StateForceExiting))
+		require.ErrorIs(t, lc.Transition(StateStopping), ErrInvalidTransition, "force exit is final")
+	})
+
+	t.Run("state contexts follow the state", func(t *testing.T) {
+		lc := NewLifecycle()
+		assert.Error(t, lc.Context(StateStarting).Err(), "the initial state is entered on creation")
+		assert.NoError(t, lc.Context(StateReady).Err())
+
+		// going straight to stopping releases what waits for the drain as well
+		require.NoError(t, lc.Transition(StateStopping))
+		assert.Error(t, lc.Context(StateReady).Err())
+		assert.Error(t, lc.Context(StateDraining).Err())
+		assert.Error(t, lc.Context(StateStopping).Err())
+		assert.NoError(t, lc.Context(StateStopped).Err())
+		assert.NoError(t, lc.Context(StateForceExiting).Err())
+
+		assert.Panics(t, func() { lc.Context(State(42)) })
+	})
+
+	t.Run("subscribers see transitions in order", func(t *testing.T) {
+		lc := NewLifecycle()
+		var seen []string
+		lc.Subscribe(func(from, to State) { seen = append(seen, "a:"+from.String()+">"+to.String()) })
+		unsubscribe := lc.Subscribe(func(_, to State) {
+			assert.Error(t, lc.Context(to).Err(), "the state context is canceled before subscribers run")
+			seen = append(seen, "b:"+to.String())
+		})
+
+		require.NoError(t, lc.Transition(StateReady))
+		unsubscribe()
+		require.NoError(t, lc.Transition(StateDraining))
+		require.Error(t, lc.Transition(StateStarting))
+
+		assert.Equal(t, []string{"a:starting>ready", "b:ready", "a:ready>draining"}, seen)
+	})
+
+	t.Run("state names", func(t *testing.T) {
+		assert.Equal(t, "force-exiting", StateForceExiting.String())
+		assert.Equal(t, "state(42)", State(42).String())
+	})
+}
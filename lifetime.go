@@ -0,0 +1,90 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrPlannedRestart is the shutdown cause recorded when the lifetime set with WithMaxLifetime ran out
+// or the restart window set with WithRestartWindow was reached. The cause wraps it with the details,
+// so logs and exit codes can tell a planned restart from a failure.
+var ErrPlannedRestart = errors.New("planned restart")
+
+// WithMaxLifetime triggers the shutdown once the process has run for the given lifetime plus a random
+// part of the jitter, so that instances started together do not restart together
+func WithMaxLifetime(lifetime, jitter time.Duration) ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.maxLifetime, c.lifetimeJitter = lifetime, jitter
+	}
+}
+
+// WithRestartWindow triggers the shutdown at a random moment of a daily window in local time, given as
+// offsets from midnight, e.g. 3*time.Hour and 4*time.Hour for a restart between 03:00 and 04:00. A
+// window ending before it starts spans midnight. A process started inside the window, as after the
+// restart itself, waits for the next day's
+func WithRestartWindow(start, end time.Duration) ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.restartWindow = true
+		c.windowStart, c.windowEnd = start, end
+	}
+}
+
+// plannedRestart returns when the process is due for a restart and the reason, a nil reason if no
+// restart is planned. Of the lifetime and the window the earliest wins.
+func plannedRestart(c *shutdownConfig, now time.Time, rnd func(n int64) int64) (at time.Time, cause error) {
+	if c.maxLifetime > 0 {
+		lifetime := c.maxLifetime + jitter(c.lifetimeJitter, rnd)
+		at, cause = now.Add(lifetime), fmt.Errorf("%w: max lifetime %s reached", ErrPlannedRestart, lifetime)
+	}
+	if c.restartWindow {
+		next := nextInWindow(now, c.windowStart, c.windowEnd, rnd)
+		if at.IsZero() || next.Before(at) {
+			at, cause = next, fmt.Errorf("%w: restart window %s-%s reached", ErrPlannedRestart, c.windowStart, c.windowEnd)
+		}
+	}
+	return at, cause
+}
+
+// nextInWindow returns a random moment of the first daily window, given as offsets from local midnight,
+// that starts after now. A window already open is skipped: the time is computed at start, so one
+// started inside the window was restarted by it and would otherwise restart again until it closes.
+func nextInWindow(now time.Time, start, end time.Duration, rnd func(n int64) int64) time.Time {
+	if end <= start {
+		end += 24 * time.Hour // the window spans midnight
+	}
+	for day := 0; ; day++ {
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+day, 0, 0, 0, 0, now.Location())
+		from, to := midnight.Add(start), midnight.Add(end)
+		if !from.After(now) {
+			continue
+		}
+		return from.Add(jitter(to.Sub(from), rnd))
+	}
+}
+
+// jitter returns a random duration in [0, d), zero for a non-positive d.
+func jitter(d time.Duration, rnd func(n int64) int64) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rnd(int64(d)))
+}
+
+// randInt64N draws the jitter, it does not need a secure source.
+func randInt64N(n int64) int64 {
+	return rand.Int64N(n) //nolint:gosec // jitter only
+}
+
+// watchLifetime triggers the planned restart at the given moment unless the context ends first.
+func watchLifetime(ctx context.Context, at time.Time, cause error, trigger func(error)) {
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+		trigger(cause)
+	}
+}
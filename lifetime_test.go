@@ -0,0 +1,78 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextInWindow(t *testing.T) {
+	loc := time.FixedZone("test", 2*60*60)
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 5, day, hour, minute, 0, 0, loc) }
+	lowest := func(int64) int64 { return 0 }
+	highest := func(n int64) int64 { return n - 1 }
+
+	tbl := []struct {
+		name       string
+		now        time.Time
+		start, end time.Duration
+		rnd        func(int64) int64
+		want       time.Time
+	}{
+		{"window later today", at(10, 1, 0), 3 * time.Hour, 4 * time.Hour, lowest, at(10, 3, 0)},
+		{"window passed today", at(10, 5, 0), 3 * time.Hour, 4 * time.Hour, lowest, at(11, 3, 0)},
+		{"inside the window, the next day's", at(10, 3, 30), 3 * time.Hour, 4 * time.Hour, lowest, at(11, 3, 0)},
+		{"at the window start, the next day's", at(10, 3, 0), 3 * time.Hour, 4 * time.Hour, lowest, at(11, 3, 0)},
+		{"drawn from the whole window", at(10, 1, 0), 3 * time.Hour, 4 * time.Hour, highest,
+			at(10, 4, 0).Add(-time.Nanosecond)},
+		{"spanning midnight, before it", at(10, 22, 0), 23 * time.Hour, time.Hour, lowest, at(10, 23, 0)},
+		{"spanning midnight, inside after it", at(11, 0, 30), 23 * time.Hour, time.Hour, lowest, at(11, 23, 0)},
+		{"spanning midnight, passed", at(11, 2, 0), 23 * time.Hour, time.Hour, lowest, at(11, 23, 0)},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nextInWindow(tt.now, tt.start, tt.end, tt.rnd))
+		})
+	}
+}
+
+func TestPlannedRestart(t *testing.T) {
+	now := time.Date(2024, 5, 10, 1, 0, 0, 0, time.UTC)
+	half := func(n int64) int64 { return n / 2 }
+
+	_, cause := plannedRestart(&shutdownConfig{}, now, half)
+	require.NoError(t, cause, "nothing planned by default")
+
+	at, cause := plannedRestart(&shutdownConfig{maxLifetime: time.Hour, lifetimeJitter: 10 * time.Minute}, now, half)
+	require.ErrorIs(t, cause, ErrPlannedRestart)
+	assert.Equal(t, now.Add(65*time.Minute), at)
+	assert.Contains(t, cause.Error(), "max lifetime 1h5m0s reached")
+
+	// the window comes before the end of the lifetime
+	at, cause = plannedRestart(&shutdownConfig{maxLifetime: 24 * time.Hour, restartWindow: true,
+		windowStart: 3 * time.Hour, windowEnd: 4 * time.Hour}, now, half)
+	require.ErrorIs(t, cause, ErrPlannedRestart)
+	assert.Equal(t, now.Add(150*time.Minute), at)
+	assert.Contains(t, cause.Error(), "restart window 3h0m0s-4h0m0s reached")
+}
+
+func TestMaxLifetime(t *testing.T) {
+	ctx, cancel := GracefulShutdown(
+		WithMaxLifetime(50*time.Millisecond, 50*time.Millisecond),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithoutForceExit(),
+	)
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(waitLimit):
+		t.Fatal("max lifetime did not trigger the shutdown")
+	}
+	require.ErrorIs(t, context.Cause(ctx), ErrPlannedRestart)
+}
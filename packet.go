@@ -0,0 +1,238 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PacketOption represents a functional option for RunPacketServerWithContext.
+type PacketOption func(*packetOptions)
+
+type packetOptions struct {
+	shutdownTimeout time.Duration
+	logger          *slog.Logger
+	workers         int
+	queueSize       int
+	maxPacketSize   int
+}
+
+// WithPacketShutdownTimeout sets the maximum time to wait for the queued packets to be handled.
+func WithPacketShutdownTimeout(timeout time.Duration) PacketOption {
+	return func(o *packetOptions) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithPacketLogger sets a custom logger for the packet server.
+func WithPacketLogger(logger *slog.Logger) PacketOption {
+	return func(o *packetOptions) {
+		o.logger = logger
+	}
+}
+
+// WithPacketWorkers sets the number of workers handling packets, GOMAXPROCS by default.
+func WithPacketWorkers(workers int) PacketOption {
+	return func(o *packetOptions) {
+		o.workers = workers
+	}
+}
+
+// WithPacketQueueSize sets how many packets wait for a worker before new ones are dropped, 1024 by default.
+func WithPacketQueueSize(size int) PacketOption {
+	return func(o *packetOptions) {
+		o.queueSize = size
+	}
+}
+
+// WithPacketMaxSize sets the size of the read buffer, larger packets are truncated. 65535 by default.
+func WithPacketMaxSize(size int) PacketOption {
+	return func(o *packetOptions) {
+		o.maxPacketSize = size
+	}
+}
+
+// RunPacketServerWithContext reads packets from the connection and dispatches them to a bounded pool
+// of workers calling the handler, e.g. for syslog or metrics ingestion over UDP. A packet arriving while
+// the queue is full is dropped rather than slowing the reads down. When the provided context is canceled
+// reading stops, the queued packets are handled within the shutdown timeout and the connection is
+// closed; the handler context is canceled if the timeout expires, the packets still queued then dropped.
+// The handler owns neither the packet, valid until it returns, nor the connection, usable for replies.
+//
+// It mirrors the error channel of RunHTTPServerWithContext: the result is published once the server
+// stopped, a shutdown timeout is reported as an error wrapping context.DeadlineExceeded along with the
+// number of packets dropped, and a connection failing on its own is reported right away. The number of
+// packets dropped is logged once the server stopped.
+func RunPacketServerWithContext(ctx context.Context, conn net.PacketConn, handler func(ctx context.Context, packet []byte, addr net.Addr),
+	opts ...PacketOption) <-chan error {
+	options := packetOptions{
+		shutdownTimeout: 10 * time.Second, // default timeout
+		logger:          slog.Default(),
+		workers:         runtime.GOMAXPROCS(0),
+		queueSize:       1024,
+		maxPacketSize:   65535,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	s := &packetServer{conn: conn, handler: handler, options: options, handlerCtx: handlerCtx,
+		cancelHandlers: cancelHandlers, queue: make(chan packet, options.queueSize), done: make(chan struct{}),
+		abandon: make(chan struct{})}
+	s.startWorkers()
+
+	return RunService(ctx, s,
+		WithServiceShutdownTimeout(options.shutdownTimeout),
+		WithServiceLogger(options.logger),
+		WithServiceName(conn.LocalAddr().String()),
+		withServiceKind(conn.LocalAddr().Network()),
+	)
+}
+
+// packet is a packet waiting for a worker.
+type packet struct {
+	data []byte
+	addr net.Addr
+}
+
+// packetServer is the Service behind RunPacketServerWithContext.
+type packetServer struct {
+	conn           net.PacketConn
+	handler        func(ctx context.Context, packet []byte, addr net.Addr)
+	options        packetOptions
+	handlerCtx     context.Context
+	cancelHandlers context.CancelFunc
+
+	queue    chan packet   // closed once reading stopped
+	done     chan struct{} // closed once the workers are done with the queue
+	stopping atomic.Bool
+	abandon  chan struct{} // closed once the shutdown timed out, the workers stop taking packets
+	dropped  atomic.Int64  // packets dropped on a full queue
+
+	takeMu    sync.Mutex // held while taking a packet, so the shutdown sees every packet taken too late
+	abandoned int64      // packets taken after the shutdown timed out, dropped
+}
+
+// startWorkers starts the pool handling the queued packets until the queue is closed.
+func (s *packetServer) startWorkers() {
+	var wg sync.WaitGroup
+	for range max(s.options.workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				p, ok := s.take()
+				if !ok {
+					return
+				}
+				s.handler(s.handlerCtx, p.data, p.addr)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		s.cancelHandlers()
+		close(s.done)
+	}()
+}
+
+// take returns the next queued packet, false once the queue is closed or the shutdown timed out. A
+// packet taken as the shutdown times out is dropped rather than handled with a canceled context.
+func (s *packetServer) take() (packet, bool) {
+	s.takeMu.Lock()
+	defer s.takeMu.Unlock()
+	select {
+	case <-s.abandon:
+		return packet{}, false
+	case p, ok := <-s.queue:
+		if !ok {
+			return packet{}, false
+		}
+		select {
+		case <-s.abandon:
+			s.abandoned++
+			return packet{}, false
+		default:
+		}
+		return p, true
+	}
+}
+
+// Run reads packets and queues them until reading is stopped.
+func (s *packetServer) Run(ctx context.Context) error {
+	defer close(s.queue)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.stop()
+		case <-stopped:
+		}
+	}()
+
+	buf := make([]byte, s.options.maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if n > 0 {
+			select {
+			case s.queue <- packet{data: append([]byte(nil), buf[:n]...), addr: addr}:
+			default:
+				s.dropped.Add(1)
+			}
+		}
+		if err != nil {
+			if s.stopping.Load() {
+				return nil
+			}
+			return fmt.Errorf("read packet: %w", err)
+		}
+	}
+}
+
+// Shutdown stops reading and waits for the queued packets to be handled until the context ends, then
+// drops the remaining ones. The connection is closed either way.
+func (s *packetServer) Shutdown(ctx context.Context) error {
+	s.stop()
+	defer s.conn.Close()
+
+	var err error
+	var abandoned int64
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		close(s.abandon)
+		s.cancelHandlers()
+		// closing the connection ends the pending read, so the reader closes the queue; holding takeMu
+		// keeps the workers out while the packets left are counted along with those taken too late
+		s.conn.Close()
+		s.takeMu.Lock()
+		for range s.queue {
+			s.abandoned++
+		}
+		abandoned = s.abandoned
+		s.takeMu.Unlock()
+		err = fmt.Errorf("dropped %d queued packets: %w", abandoned, ctx.Err())
+	}
+	s.options.logger.Info("packet server stopped", "addr", s.conn.LocalAddr().String(),
+		"dropped", s.dropped.Load()+abandoned)
+	return err
+}
+
+// stop makes the pending read return, repeated calls do nothing.
+func (s *packetServer) stop() {
+	if s.stopping.Swap(true) {
+		return
+	}
+	if err := s.conn.SetReadDeadline(time.Now()); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.options.logger.Warn("can't stop packet reads", "error", err)
+	}
+}
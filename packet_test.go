@@ -0,0 +1,91 @@
+package ctrl
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPacketServerWithContext(t *testing.T) {
+	t.Run("queued packets handled on shutdown", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		var mu sync.Mutex
+		var got []string
+		first, release := make(chan struct{}), make(chan struct{})
+		var once sync.Once
+		handler := func(_ context.Context, p []byte, _ net.Addr) {
+			once.Do(func() {
+				close(first)
+				<-release // holds the only worker while the others queue up
+			})
+			mu.Lock()
+			got = append(got, string(p))
+			mu.Unlock()
+		}
+		logs := &lockedBuffer{}
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunPacketServerWithContext(ctx, conn, handler, WithPacketWorkers(1), WithPacketQueueSize(2),
+			WithPacketLogger(slog.New(slog.NewTextHandler(logs, nil))))
+
+		client, err := net.Dial("udp", conn.LocalAddr().String())
+		require.NoError(t, err)
+		defer client.Close()
+		_, err = client.Write([]byte("p1"))
+		require.NoError(t, err)
+		<-first
+		for _, p := range []string{"p2", "p3", "p4"} {
+			_, err = client.Write([]byte(p))
+			require.NoError(t, err)
+		}
+		time.Sleep(50 * time.Millisecond) // lets the packets be read, p4 finds the queue full
+
+		cancel()
+		close(release)
+		require.NoError(t, <-errCh)
+		assert.Equal(t, []string{"p1", "p2", "p3"}, got)
+		assert.Contains(t, logs.String(), "dropped=1")
+		_, _, err = conn.ReadFrom(make([]byte, 1))
+		require.ErrorIs(t, err, net.ErrClosed, "the connection is closed")
+	})
+
+	t.Run("queued packets dropped after the timeout", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		started := make(chan struct{}, 10)
+		handler := func(ctx context.Context, _ []byte, _ net.Addr) {
+			started <- struct{}{}
+			<-ctx.Done()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		logs := &lockedBuffer{}
+		errCh := RunPacketServerWithContext(ctx, conn, handler, WithPacketWorkers(1),
+			WithPacketShutdownTimeout(50*time.Millisecond), WithPacketLogger(slog.New(slog.NewTextHandler(logs, nil))))
+
+		client, err := net.Dial("udp", conn.LocalAddr().String())
+		require.NoError(t, err)
+		defer client.Close()
+		_, err = client.Write([]byte("p1"))
+		require.NoError(t, err)
+		<-started
+		for _, p := range []string{"p2", "p3", "p4"} {
+			_, err = client.Write([]byte(p))
+			require.NoError(t, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		cancel()
+		err = <-errCh
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "dropped 3 queued packets")
+		assert.Contains(t, logs.String(), "dropped=3", "each packet is counted once")
+		time.Sleep(20 * time.Millisecond)
+		assert.Len(t, started, 0, "the queued packets are not handled")
+	})
+}
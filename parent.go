@@ -0,0 +1,117 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// ErrParentDied is the shutdown cause recorded when the parent process went away, as detected by the
+// watch set with WithParentWatch, or when stdin was closed with WithStdinWatch.
+var ErrParentDied = errors.New("parent process died")
+
+// WithParentWatch triggers the shutdown when the parent process goes away, so a child of a dead
+// supervisor or test harness does not linger as an orphan. On Linux the kernel is asked to send the
+// given signal on the parent's death (PR_SET_PDEATHSIG); it should be one not set with WithSignals,
+// e.g. syscall.SIGUSR2, and nil skips it. Everywhere the parent pid is also polled at the given
+// interval, a change means the process was reparented
+func WithParentWatch(sig os.Signal, interval time.Duration) ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.parentWatch = true
+		c.parentSignal = sig
+		c.parentInterval = interval
+	}
+}
+
+// WithStdinWatch triggers the shutdown when stdin is closed, which is how many supervisors and
+// harnesses holding a pipe to the process signal they are gone. Stdin is read and discarded
+func WithStdinWatch() ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.stdin = os.Stdin
+	}
+}
+
+// withGetppid is for testing only - allows faking the parent pid
+func withGetppid(fn func() int) ShutdownOption { //nolint:unused // false positive, used in tests
+	return func(c *shutdownConfig) {
+		c.getppid = fn
+	}
+}
+
+// withStdin is for testing only - allows replacing stdin watched by WithStdinWatch
+func withStdin(r io.Reader) ShutdownOption { //nolint:unused // false positive, used in tests
+	return func(c *shutdownConfig) {
+		c.stdin = r
+	}
+}
+
+// parentWatcher detects the parent process going away and reports ErrParentDied to trigger.
+type parentWatcher struct {
+	ppid     int
+	getppid  func() int
+	sigCh    chan os.Signal
+	interval time.Duration
+	trigger  func(error)
+	logger   *slog.Logger
+}
+
+// startParentWatch arms the death signal and starts the watch, which ends with the context.
+func startParentWatch(ctx context.Context, c *shutdownConfig, trigger func(error)) {
+	w := &parentWatcher{ppid: c.getppid(), getppid: c.getppid, interval: c.parentInterval,
+		trigger: trigger, logger: c.logger}
+	if w.interval <= 0 {
+		w.interval = time.Second
+	}
+
+	if c.parentSignal != nil {
+		// the signal is caught before it is armed, its default action would kill the process
+		w.sigCh = make(chan os.Signal, 1)
+		signal.Notify(w.sigCh, c.parentSignal)
+		if err := setParentDeathSignal(c.parentSignal); err != nil {
+			signal.Stop(w.sigCh)
+			w.sigCh = nil
+			w.logger.Debug("parent death signal not armed, polling the parent pid", "error", err)
+		}
+	}
+
+	go w.run(ctx)
+}
+
+// run polls the parent pid and waits for the death signal until the parent is gone or the context ends.
+func (w *parentWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	// the parent may have died before the death signal was armed, the first check does not wait
+	for {
+		if ppid := w.getppid(); ppid != w.ppid {
+			w.trigger(fmt.Errorf("%w: parent pid changed from %d to %d", ErrParentDied, w.ppid, ppid))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-w.sigCh:
+			w.trigger(fmt.Errorf("%w: received parent death signal %s", ErrParentDied, sig))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchStdin reads the input until it is closed and reports ErrParentDied to trigger. The read can not
+// be interrupted, the goroutine lives as long as the input is open.
+func watchStdin(r io.Reader, trigger func(error)) {
+	_, err := io.Copy(io.Discard, r)
+	if err != nil {
+		trigger(fmt.Errorf("%w: stdin failed: %w", ErrParentDied, err))
+		return
+	}
+	trigger(fmt.Errorf("%w: stdin closed", ErrParentDied))
+}
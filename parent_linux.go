@@ -0,0 +1,19 @@
+package ctrl
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// setParentDeathSignal asks the kernel to send the signal when the parent process dies.
+func setParentDeathSignal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("parent death signal %v is not a syscall.Signal", sig)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_PDEATHSIG, uintptr(s), 0); errno != 0 {
+		return fmt.Errorf("set parent death signal: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package ctrl
+
+import (
+	"errors"
+	"os"
+	"runtime"
+)
+
+// setParentDeathSignal is only supported on Linux, elsewhere the parent pid is polled.
+func setParentDeathSignal(os.Signal) error {
+	return errors.New("parent death signal is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,87 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParentWatch(t *testing.T) {
+	discard := WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// awaitCause waits for the shutdown and returns its cause
+	awaitCause := func(t *testing.T, ctx context.Context) error {
+		t.Helper()
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(waitLimit):
+			t.Fatal("shutdown was not triggered")
+			return nil
+		}
+	}
+
+	t.Run("reparented process", func(t *testing.T) {
+		var ppid atomic.Int64
+		ppid.Store(100)
+		ctx, cancel := GracefulShutdown(
+			WithParentWatch(nil, 10*time.Millisecond),
+			withGetppid(func() int { return int(ppid.Load()) }),
+			discard, WithoutForceExit(),
+		)
+		defer cancel()
+
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, ctx.Err(), "the parent is still there")
+
+		ppid.Store(1) // adopted by init
+		cause := awaitCause(t, ctx)
+		require.ErrorIs(t, cause, ErrParentDied)
+		assert.Contains(t, cause.Error(), "from 100 to 1")
+	})
+
+	t.Run("parent death signal", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("parent death signal is only supported on linux")
+		}
+		ctx, cancel := GracefulShutdown(
+			WithSignals(syscall.SIGUSR1),
+			WithParentWatch(syscall.SIGWINCH, time.Hour),
+			discard, WithoutForceExit(),
+		)
+		defer cancel()
+
+		// the kernel sends the signal when the parent dies, the test sends it in its place
+		process, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err)
+		require.NoError(t, process.Signal(syscall.SIGWINCH))
+
+		cause := awaitCause(t, ctx)
+		require.ErrorIs(t, cause, ErrParentDied)
+		assert.Contains(t, cause.Error(), "parent death signal")
+	})
+
+	t.Run("stdin closed", func(t *testing.T) {
+		r, w := io.Pipe()
+		ctx, cancel := GracefulShutdown(withStdin(r), discard, WithoutForceExit())
+		defer cancel()
+
+		_, err := w.Write([]byte("input is read and discarded\n"))
+		require.NoError(t, err)
+		require.NoError(t, ctx.Err())
+
+		require.NoError(t, w.Close())
+		cause := awaitCause(t, ctx)
+		require.ErrorIs(t, cause, ErrParentDied)
+		assert.Contains(t, cause.Error(), "stdin closed")
+	})
+}
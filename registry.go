@@ -0,0 +1,61 @@
+package ctrl
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ServerStatus describes a server run with a context from GracefulShutdown.
+type ServerStatus struct {
+	Kind  string    `json:"kind"` // e.g. "http"
+	Addr  string    `json:"addr"`
+	Since time.Time `json:"since"`
+}
+
+// serverRegistry keeps the servers currently running with the shutdown context.
+type serverRegistry struct {
+	mu      sync.Mutex
+	servers map[int]ServerStatus
+	nextID  int
+}
+
+// register adds a running server, the returned function removes it once it stopped.
+func (r *serverRegistry) register(kind, addr string) (unregister func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.servers == nil {
+		r.servers = map[int]ServerStatus{}
+	}
+	id := r.nextID
+	r.nextID++
+	r.servers[id] = ServerStatus{Kind: kind, Addr: addr, Since: time.Now()}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.servers, id)
+	}
+}
+
+// list returns the running servers, oldest first.
+func (r *serverRegistry) list() []ServerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]ServerStatus, 0, len(r.servers))
+	for _, s := range r.servers {
+		res = append(res, s)
+	}
+	slices.SortFunc(res, func(a, b ServerStatus) int { return a.Since.Compare(b.Since) })
+	return res
+}
+
+// registerServer records a server running with the context if it comes from GracefulShutdown,
+// the returned function removes it and does nothing otherwise.
+func registerServer(ctx context.Context, kind, addr string) (unregister func()) {
+	c := controlFrom(ctx)
+	if c == nil {
+		return func() {}
+	}
+	return c.servers.register(kind, addr)
+}
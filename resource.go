@@ -0,0 +1,175 @@
+package ctrl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrResourceLimit is the shutdown cause recorded when a resource limit set with WithHeapLimit,
+// WithRSSLimit, WithFDLimit or WithDiskSpaceLimit is crossed. The cause wraps it with the details.
+var ErrResourceLimit = errors.New("resource limit exceeded")
+
+// errResourceUnsupported is returned by a resource reader on a platform it does not support.
+var errResourceUnsupported = errors.New("not supported on this platform")
+
+// resourceCheck reports a cause wrapping ErrResourceLimit once the limit is crossed, nil while it is
+// not, and any other error if the resource can not be read, which disables the check.
+type resourceCheck struct {
+	name  string
+	check func() error
+}
+
+// WithHeapLimit triggers the shutdown once the heap, as reported by runtime/metrics, exceeds the given size
+func WithHeapLimit(bytes uint64) ShutdownOption {
+	return withResourceCheck("heap", func() error {
+		return checkLimit("heap", readHeapBytes, bytes)
+	})
+}
+
+// WithRSSLimit triggers the shutdown once the resident set size of the process exceeds the given size.
+// It is read from /proc/self/status and only available on Linux
+func WithRSSLimit(bytes uint64) ShutdownOption {
+	return withResourceCheck("rss", func() error {
+		return checkLimit("rss", readRSSBytes, bytes)
+	})
+}
+
+// WithFDLimit triggers the shutdown once the open file descriptors reach the given fraction of
+// RLIMIT_NOFILE, e.g. 0.9 for 90% of the soft limit
+func WithFDLimit(fraction float64) ShutdownOption {
+	return withResourceCheck("file descriptors", func() error {
+		open, err := readOpenFDs()
+		if err != nil {
+			return err
+		}
+		limit, err := readFDLimit()
+		if err != nil {
+			return err
+		}
+		if threshold := uint64(fraction * float64(limit)); open >= threshold {
+			return fmt.Errorf("%w: %d open file descriptors, threshold %d of %d", ErrResourceLimit, open, threshold, limit)
+		}
+		return nil
+	})
+}
+
+// WithDiskSpaceLimit triggers the shutdown once the space available to the process on the file
+// system holding the path drops below the given size
+func WithDiskSpaceLimit(path string, minFree uint64) ShutdownOption {
+	return withResourceCheck("disk space", func() error {
+		free, err := readDiskFree(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%w: %d bytes free on %s, minimum %d", ErrResourceLimit, free, path, minFree)
+		}
+		return nil
+	})
+}
+
+// WithResourceCheckInterval sets how often the resource limits are checked, 5 seconds by default
+func WithResourceCheckInterval(interval time.Duration) ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.resourceInterval = interval
+	}
+}
+
+// withResourceCheck adds a resource check run by the resource watcher
+func withResourceCheck(name string, check func() error) ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.resourceChecks = append(c.resourceChecks, resourceCheck{name: name, check: check})
+	}
+}
+
+// checkLimit reads a value and reports a cause wrapping ErrResourceLimit if it exceeds the limit.
+func checkLimit(name string, read func() (uint64, error), limit uint64) error {
+	v, err := read()
+	if err != nil {
+		return err
+	}
+	if v > limit {
+		return fmt.Errorf("%w: %s %d bytes, limit %d", ErrResourceLimit, name, v, limit)
+	}
+	return nil
+}
+
+// watchResources runs the checks on every tick until the context is canceled or a limit is crossed,
+// which is reported to trigger. A check failing to read its resource is logged and dropped.
+func watchResources(ctx context.Context, interval time.Duration, checks []resourceCheck,
+	trigger func(error), logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for len(checks) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		active := checks[:0:0]
+		for _, c := range checks {
+			err := c.check()
+			switch {
+			case err == nil:
+				active = append(active, c)
+			case errors.Is(err, ErrResourceLimit):
+				trigger(err)
+				return
+			default:
+				logger.Warn("resource check disabled", "resource", c.name, "error", err)
+			}
+		}
+		checks = active
+	}
+}
+
+// readHeapBytes returns the memory occupied by live and not yet swept heap objects.
+func readHeapBytes() (uint64, error) {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0, fmt.Errorf("heap metric %s: %w", sample[0].Name, errResourceUnsupported)
+	}
+	return sample[0].Value.Uint64(), nil
+}
+
+// readRSSBytes returns the resident set size from /proc/self/status.
+func readRSSBytes() (uint64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, fmt.Errorf("read rss: %w", err)
+	}
+	defer f.Close()
+	return parseRSS(f)
+}
+
+// parseRSS extracts VmRSS, reported in kB, from the content of /proc/self/status.
+func parseRSS(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !found {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse rss %q: %w", value, err)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read rss: %w", err)
+	}
+	return 0, errors.New("read rss: no VmRSS entry")
+}
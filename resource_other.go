@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd)
+
+package ctrl
+
+// readOpenFDs is not supported on this platform.
+func readOpenFDs() (uint64, error) { return 0, errResourceUnsupported }
+
+// readFDLimit is not supported on this platform.
+func readFDLimit() (uint64, error) { return 0, errResourceUnsupported }
+
+// readDiskFree is not supported on this platform.
+func readDiskFree(string) (uint64, error) { return 0, errResourceUnsupported }
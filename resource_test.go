@@ -0,0 +1,161 @@
+package ctrl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceReaders(t *testing.T) {
+	heap, err := readHeapBytes()
+	require.NoError(t, err)
+	assert.Positive(t, heap)
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		t.Skip("file descriptors and disk space are not supported on " + runtime.GOOS)
+	}
+
+	fds, err := readOpenFDs()
+	require.NoError(t, err)
+	assert.Positive(t, fds)
+	limit, err := readFDLimit()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, limit, fds)
+
+	free, err := readDiskFree(t.TempDir())
+	require.NoError(t, err)
+	assert.Positive(t, free)
+	_, err = readDiskFree("/no/such/path")
+	require.Error(t, err)
+
+	if runtime.GOOS == "linux" {
+		rss, err := readRSSBytes()
+		require.NoError(t, err)
+		assert.Positive(t, rss)
+	}
+}
+
+func TestParseRSS(t *testing.T) {
+	rss, err := parseRSS(strings.NewReader("Name:\tctrl\nVmPeak:\t  20000 kB\nVmRSS:\t   1234 kB\n"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1234*1024), rss)
+
+	_, err = parseRSS(strings.NewReader("Name:\tctrl\n"))
+	require.Error(t, err)
+	_, err = parseRSS(strings.NewReader("VmRSS:\tlots kB\n"))
+	require.Error(t, err)
+}
+
+func TestResourceLimits(t *testing.T) {
+	t.Run("crossed limit triggers the shutdown with its cause", func(t *testing.T) {
+		var shutdownSig os.Signal = syscall.SIGHUP
+		shutdownCalled := make(chan struct{})
+		ctx, cancel := GracefulShutdown(
+			WithHeapLimit(1), // any running program exceeds it
+			WithResourceCheckInterval(10*time.Millisecond),
+			WithOnShutdown(func(sig os.Signal) {
+				shutdownSig = sig
+				close(shutdownCalled)
+			}),
+			WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			WithoutForceExit(),
+		)
+		defer cancel()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(waitLimit):
+			t.Fatal("resource limit did not trigger the shutdown")
+		}
+		cause := context.Cause(ctx)
+		require.ErrorIs(t, cause, ErrResourceLimit)
+		assert.Contains(t, cause.Error(), "heap")
+		<-shutdownCalled
+		assert.Nil(t, shutdownSig, "no signal triggered the shutdown")
+	})
+
+	t.Run("unreadable resource disables its check", func(t *testing.T) {
+		checks := make(chan struct{}, 10)
+		logs := &lockedBuffer{}
+		ctx, cancel := GracefulShutdown(
+			withResourceCheck("broken", func() error {
+				checks <- struct{}{}
+				return errResourceUnsupported
+			}),
+			WithDiskSpaceLimit(t.TempDir(), 0),
+			WithResourceCheckInterval(10*time.Millisecond),
+			WithLogger(slog.New(slog.NewTextHandler(logs, nil))),
+			WithoutForceExit(),
+		)
+		defer cancel()
+
+		<-checks
+		time.Sleep(100 * time.Millisecond)
+		assert.Len(t, checks, 0, "the check is not run again")
+		require.NoError(t, ctx.Err())
+		assert.Contains(t, logs.String(), "resource check disabled")
+	})
+
+	t.Run("signal after a trigger does not force the exit", func(t *testing.T) {
+		exitCalls := make(chan int, 1)
+		lc := NewLifecycle()
+		ctx, cancel := GracefulShutdown(
+			WithSignals(syscall.SIGUSR1),
+			WithLifecycle(lc),
+			WithTimeout(time.Hour),
+			withResourceCheck("test", func() error { return fmt.Errorf("%w: test", ErrResourceLimit) }),
+			WithResourceCheckInterval(10*time.Millisecond),
+			WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			withOsExit(func(code int) { exitCalls <- code }),
+		)
+		defer cancel()
+		<-ctx.Done()
+
+		process, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err)
+		require.NoError(t, process.Signal(syscall.SIGUSR1))
+		select {
+		case <-exitCalls:
+			t.Fatal("the first signal forced the exit")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		require.NoError(t, process.Signal(syscall.SIGUSR1))
+		select {
+		case code := <-exitCalls:
+			assert.Equal(t, 1, code)
+		case <-time.After(waitLimit):
+			t.Fatal("the second signal did not force the exit")
+		}
+		assert.Equal(t, StateForceExiting, lc.State())
+	})
+}
+
+// lockedBuffer is a log destination safe to read while a background goroutine writes to it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd
+
+package ctrl
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// readOpenFDs counts the open file descriptors of the process.
+func readOpenFDs() (uint64, error) {
+	dir := "/dev/fd"
+	if runtime.GOOS == "linux" {
+		dir = "/proc/self/fd"
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("read open file descriptors: %w", err)
+	}
+	// reading the directory holds a descriptor of its own, it is not counted
+	return uint64(max(len(entries)-1, 0)), nil
+}
+
+// readFDLimit returns the soft RLIMIT_NOFILE of the process.
+func readFDLimit() (uint64, error) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, fmt.Errorf("read file descriptor limit: %w", err)
+	}
+	return uint64(rlim.Cur), nil //nolint:unconvert // the field type differs between platforms
+}
+
+// readDiskFree returns the space available to unprivileged users on the file system holding the path.
+func readDiskFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("read free disk space of %s: %w", path, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil //nolint:gosec,unconvert // the field types differ between platforms
+}
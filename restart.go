@@ -0,0 +1,52 @@
+package ctrl
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// RestartPolicy tells how a component failing on its own is restarted.
+type RestartPolicy struct {
+	MaxAttempts    int                  // restarts in a row before giving up, 0 for no limit
+	InitialBackoff time.Duration        // the wait before the first restart, 100ms if zero
+	MaxBackoff     time.Duration        // the cap of the wait doubling with each restart, 30 seconds if zero
+	Jitter         float64              // the fraction of the wait added at random, e.g. 0.2 for up to 20%
+	ResetAfter     time.Duration        // a run lasting that long resets the attempts and the wait, never if zero
+	Retryable      func(err error) bool // the failures worth a restart, RetryableServeError if nil
+}
+
+// RetryableServeError reports whether a server failure is worth a restart: the address being in use,
+// as during a rolling restart where the previous process has not released it yet, or not available yet.
+func RetryableServeError(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE) || errors.Is(err, syscall.EADDRNOTAVAIL)
+}
+
+// retryable reports whether the failure is worth a restart.
+func (p RestartPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return RetryableServeError(err)
+}
+
+// exhausted reports whether the given number of restarts in a row used up the attempts.
+func (p RestartPolicy) exhausted(restarts int) bool {
+	return p.MaxAttempts > 0 && restarts >= p.MaxAttempts
+}
+
+// backoff returns the wait before the restart with the given number, counting from 1.
+func (p RestartPolicy) backoff(restart int, rnd func(n int64) int64) time.Duration {
+	d, maxBackoff := p.InitialBackoff, p.MaxBackoff
+	if d <= 0 {
+		d = 100 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	for i := 1; i < restart && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	return d + jitter(time.Duration(p.Jitter*float64(d)), rnd)
+}
@@ -0,0 +1,188 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Service is a long-running component, e.g. a gRPC server, a custom TCP server or a queue consumer,
+// run by RunService. Run serves until the service is stopped; the context it gets is canceled once
+// the service is asked to stop, after Shutdown returned for a service implementing ServiceShutdowner.
+type Service interface {
+	Run(ctx context.Context) error
+}
+
+// ServiceShutdowner is implemented by services stopping gracefully through a call of their own,
+// e.g. an http.Server or a gRPC server with GracefulStop. Shutdown is expected to return once the
+// service drained or the context expired.
+type ServiceShutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// ServiceFunc turns a function serving until its context is canceled into a Service.
+type ServiceFunc func(ctx context.Context) error
+
+// Run calls the function.
+func (f ServiceFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// NewService makes a Service from a run function and the function stopping it gracefully,
+// e.g. the Serve and GracefulStop pair of a gRPC server. Without a shutdown function the service is
+// stopped through the context of the run function only, as a ServiceFunc.
+func NewService(run, shutdown func(ctx context.Context) error) Service {
+	if shutdown == nil {
+		return ServiceFunc(run)
+	}
+	return &funcService{run: run, shutdown: shutdown}
+}
+
+type funcService struct {
+	run, shutdown func(ctx context.Context) error
+}
+
+func (s *funcService) Run(ctx context.Context) error      { return s.run(ctx) }
+func (s *funcService) Shutdown(ctx context.Context) error { return s.shutdown(ctx) }
+
+// HTTPService makes a Service of an HTTP server, run with ListenAndServe and stopped with Shutdown.
+func HTTPService(server *http.Server) Service {
+	return NewService(
+		func(context.Context) error { return serveResult(server.ListenAndServe()) },
+		server.Shutdown,
+	)
+}
+
+// ServiceOption represents a functional option for RunService.
+type ServiceOption func(*serviceOptions)
+
+type serviceOptions struct {
+	shutdownTimeout time.Duration
+	logger          *slog.Logger
+	name            string
+	kind            string // the kind the service is registered with
+}
+
+// WithServiceShutdownTimeout sets the maximum time to wait for the service to stop.
+func WithServiceShutdownTimeout(timeout time.Duration) ServiceOption {
+	return func(o *serviceOptions) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithServiceLogger sets a custom logger for the service run.
+func WithServiceLogger(logger *slog.Logger) ServiceOption {
+	return func(o *serviceOptions) {
+		o.logger = logger
+	}
+}
+
+// WithServiceName sets the name identifying the service in logs, errors and the control socket status.
+func WithServiceName(name string) ServiceOption {
+	return func(o *serviceOptions) {
+		o.name = name
+	}
+}
+
+// withServiceKind sets the kind the service is registered with, "service" by default.
+func withServiceKind(kind string) ServiceOption {
+	return func(o *serviceOptions) {
+		o.kind = kind
+	}
+}
+
+// RunService runs the service and stops it gracefully when the provided context is canceled, with the
+// semantics of RunHTTPServerWithContext. The returned channel publishes the result once the service
+// stopped: Shutdown is called with its own deadline set by WithServiceShutdownTimeout, then the
+// context of Run is canceled and Run awaited within what is left of it. If the deadline expires first
+// the error is published right away and can be inspected with errors.Is(err, context.DeadlineExceeded).
+// The context.Canceled returned by Run once asked to stop is not an error. A service whose Run returns
+// on its own reports right away and is left untouched, so it can be run again.
+func RunService(ctx context.Context, svc Service, opts ...ServiceOption) <-chan error {
+	options := serviceOptions{
+		shutdownTimeout: 10 * time.Second, // default timeout
+		logger:          slog.Default(),
+		name:            "service",
+		kind:            "service",
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// Run is stopped by the runner, not directly by the caller's context, keeping its values
+	runCtx, cancelRun := context.WithCancel(context.WithoutCancel(ctx))
+
+	errCh := make(chan error, 1)
+	runCh := make(chan error, 1)
+	go func() { runCh <- svc.Run(runCtx) }()
+
+	unregister := registerServer(ctx, options.kind, options.name)
+
+	go func() {
+		defer close(errCh)
+		defer cancelRun()
+		defer unregister()
+
+		select {
+		case err := <-runCh:
+			errCh <- err
+			return
+		case <-ctx.Done():
+			// both can be ready at once, and a service that already stopped is not shut down
+			select {
+			case err := <-runCh:
+				errCh <- err
+				return
+			default:
+			}
+		}
+
+		options.logger.Info("shutting down service", "name", options.name)
+
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), options.shutdownTimeout)
+		defer cancel()
+
+		var shutdownErr error
+		if s, ok := svc.(ServiceShutdowner); ok {
+			if err := s.Shutdown(shutdownCtx); err != nil {
+				shutdownErr = fmt.Errorf("shutdown service %s: %w", options.name, err)
+			}
+		}
+		cancelRun()
+
+		var runErr error
+		if shutdownErr == nil {
+			select {
+			case err := <-runCh:
+				runErr = stopResult(err)
+			case <-shutdownCtx.Done():
+				shutdownErr = fmt.Errorf("stop service %s: %w", options.name, shutdownCtx.Err())
+			}
+		} else {
+			// the shutdown already gave up, waiting on Run on top of that would defeat the timeout
+			select {
+			case err := <-runCh:
+				runErr = stopResult(err)
+			default:
+			}
+		}
+		if shutdownErr != nil {
+			options.logger.Error("service shutdown error", "name", options.name, "error", shutdownErr)
+		}
+		errCh <- errors.Join(runErr, shutdownErr)
+	}()
+
+	return errCh
+}
+
+// stopResult converts the result of Run once the service was asked to stop, dropping the cancellation.
+func stopResult(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunService(t *testing.T) {
+	logger := WithServiceLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	t.Run("func service stopped through its context", func(t *testing.T) {
+		started := make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunService(ctx, ServiceFunc(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}), logger)
+		<-started
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("shutdown called before the run context is canceled", func(t *testing.T) {
+		runCtx := make(chan context.Context, 1)
+		var runAlive bool
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunService(ctx, NewService(
+			func(ctx context.Context) error {
+				runCtx <- ctx
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			func(context.Context) error {
+				runAlive = (<-runCtx).Err() == nil
+				return nil
+			},
+		), logger)
+		cancel()
+		require.NoError(t, <-errCh)
+		assert.True(t, runAlive, "the run context is canceled after the shutdown")
+	})
+
+	t.Run("service without a shutdown function", func(t *testing.T) {
+		svc := NewService(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, nil)
+		_, ok := svc.(ServiceShutdowner)
+		assert.False(t, ok)
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunService(ctx, svc, logger)
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("service failing on its own", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		shutdownCalled := false
+		errCh := RunService(context.Background(), NewService(
+			func(context.Context) error { return errBoom },
+			func(context.Context) error { shutdownCalled = true; return nil },
+		), logger)
+		require.ErrorIs(t, <-errCh, errBoom)
+		assert.False(t, shutdownCalled)
+	})
+
+	t.Run("shutdown error and timeout", func(t *testing.T) {
+		errShutdown := errors.New("shutdown failed")
+		release := make(chan struct{})
+		defer close(release)
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunService(ctx, NewService(
+			func(context.Context) error { <-release; return nil },
+			func(context.Context) error { return errShutdown },
+		), logger, WithServiceName("consumer"))
+		cancel()
+		err := <-errCh
+		require.ErrorIs(t, err, errShutdown)
+		assert.Contains(t, err.Error(), "shutdown service consumer")
+
+		ctx, cancel = context.WithCancel(context.Background())
+		errCh = RunService(ctx, ServiceFunc(func(context.Context) error { <-release; return nil }),
+			logger, WithServiceShutdownTimeout(50*time.Millisecond))
+		cancel()
+		select {
+		case err := <-errCh:
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+		case <-time.After(waitLimit):
+			t.Fatal("the run was awaited past the timeout")
+		}
+	})
+
+	t.Run("http server registered as a service", func(t *testing.T) {
+		ctx, cancel := GracefulShutdown(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), WithoutForceExit())
+		defer cancel()
+		server := &http.Server{Addr: freeAddr(t), ReadHeaderTimeout: time.Second,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })}
+		errCh := RunService(ctx, HTTPService(server), logger, WithServiceName("api"))
+
+		require.Eventually(t, func() bool {
+			resp, err := http.Get("http://" + server.Addr)
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK
+		}, waitLimit, 10*time.Millisecond)
+		servers := controlFrom(ctx).servers.list()
+		require.Len(t, servers, 1)
+		assert.Equal(t, "service", servers[0].Kind)
+		assert.Equal(t, "api", servers[0].Addr)
+
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+}
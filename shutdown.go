@@ -2,6 +2,7 @@ package ctrl
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -12,6 +13,18 @@ import (
 // GracefulShutdown handles process termination with graceful shutdown.
 // It returns a context that is canceled when a termination signal is received
 // and a cancel function that can be called to trigger shutdown manually.
+//
+// Besides signals, the shutdown can be triggered by the resource limits set with WithHeapLimit,
+// WithRSSLimit, WithFDLimit and WithDiskSpaceLimit, by the parent process going away with
+// WithParentWatch and WithStdinWatch, and by a planned restart with WithMaxLifetime and
+// WithRestartWindow. The reason is recorded as the cause of the returned context, a *SignalError for
+// a signal, and can be read with context.Cause; the WithOnShutdown callback gets a nil signal when
+// the shutdown was not triggered by one.
+//
+// The shutdown moves the lifecycle set with WithLifecycle to StateDraining when the signal
+// arrives and to StateStopping when the returned context is canceled, after the drain delay set
+// with WithDrainDelay; a forced exit moves it to StateForceExiting. The timeout counts from the
+// signal and covers the drain delay.
 func GracefulShutdown(opts ...ShutdownOption) (context.Context, context.CancelFunc) {
 	config := shutdownConfig{
 		signals:     []os.Signal{os.Interrupt, syscall.SIGTERM},
@@ -21,43 +34,182 @@ func GracefulShutdown(opts ...ShutdownOption) (context.Context, context.CancelFu
 		onShutdown:  func(_ os.Signal) {},
 		onForceExit: func() {},
 		logger:      slog.Default(),
-		osExit:      os.Exit,
+		leakSettle:  -1,
+
+		resourceInterval: 5 * time.Second,
+		getppid:          os.Getppid,
+		osExit:           os.Exit,
 	}
 
 	for _, opt := range opts {
 		opt(&config)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// the leak report runs once the caller moves the lifecycle to Stopped, so it needs one they can reach
+	callerLifecycle := config.lifecycle != nil
+	if config.lifecycle == nil {
+		config.lifecycle = NewLifecycle()
+	}
+	lc := config.lifecycle
+
+	ctx, cancelCtx := context.WithCancelCause(context.Background())
+	// the transition fails harmlessly when the lifecycle is already past Stopping
+	stop := func(cause error) {
+		_ = lc.Transition(StateStopping)
+		cancelCtx(cause)
+	}
+	// a manual shutdown skips the drain, the caller asks for the components to stop right away
+	cancel := func() { stop(context.Canceled) }
+
+	// triggers other than signals report their cause here, only the first one starts the shutdown
+	triggerCh := make(chan error, 1)
+	trigger := func(cause error) {
+		select {
+		case triggerCh <- cause:
+		default:
+		}
+	}
+
+	// the context carries the trigger, so components handed it can start the shutdown on their own
+	ctx = context.WithValue(ctx, shutdownControlKey{}, &shutdownControl{
+		trigger: trigger, lifecycle: lc, callerLifecycle: callerLifecycle, started: time.Now(), servers: &serverRegistry{}})
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, config.signals...)
 
 	go func() {
-		sig := <-sigChan
-		config.logger.Warn("received signal, shutting down...", "signal", sig)
+		var sig os.Signal
+		var cause error
+		// a shutdown started by a signal is forced by the next one, any other by the second one, so an
+		// orchestrator stopping a process that is already restarting on its own does not force it
+		forceAfter := 1
+		select {
+		case sig = <-sigChan:
+			cause = &SignalError{Signal: sig}
+			config.logger.Warn("received signal, shutting down...", "signal", sig)
+		case cause = <-triggerCh:
+			forceAfter = 2
+			config.logger.Warn("shutdown triggered, shutting down...", "cause", cause)
+		}
+		_ = lc.Transition(StateDraining)
 		config.onShutdown(sig)
-		cancel() // trigger graceful shutdown
+
+		// a nil channel never fires, so without the forced exit the waits below only wait for the drain
+		var deadline <-chan time.Time
+		var moreSigs <-chan os.Signal
+		if config.forceExit {
+			deadline, moreSigs = time.After(config.timeout), sigChan
+		}
+
+		// wait blocks until done fires and reports true, or forces the exit on the timeout or on
+		// enough signals and reports false; a nil done waits for the forced exit only
+		wait := func(done <-chan time.Time) bool {
+			for {
+				select {
+				case <-done:
+					return true
+				case <-deadline:
+					config.logger.Warn("forced exit after timeout", "timeout", config.timeout)
+				case sig := <-moreSigs:
+					if forceAfter--; forceAfter > 0 {
+						config.logger.Warn("received signal while shutting down", "signal", sig)
+						continue
+					}
+					config.logger.Warn("received second signal, forcing exit", "signal", sig)
+				}
+				_ = lc.Transition(StateForceExiting)
+				config.onForceExit()
+				config.osExit(config.exitCode)
+				return false
+			}
+		}
+
+		if config.drainDelay > 0 && !wait(time.After(config.drainDelay)) {
+			return
+		}
+
+		stop(cause) // trigger graceful shutdown
 
 		if !config.forceExit {
 			return
 		}
 
 		// wait for timeout or second signal
-		select {
-		case <-time.After(config.timeout):
-			config.logger.Warn("forced exit after timeout", "timeout", config.timeout)
-			config.onForceExit()
-			config.osExit(config.exitCode)
-		case sig := <-sigChan:
-			config.logger.Warn("received second signal, forcing exit", "signal", sig)
-			config.onForceExit()
-			config.osExit(config.exitCode)
-		}
+		wait(nil)
 	}()
 
+	if len(config.resourceChecks) > 0 {
+		go watchResources(ctx, config.resourceInterval, config.resourceChecks, trigger, config.logger)
+	}
+	if config.parentWatch {
+		startParentWatch(ctx, &config, trigger)
+	}
+	if config.stdin != nil {
+		go watchStdin(config.stdin, trigger)
+	}
+	if at, cause := plannedRestart(&config, time.Now(), randInt64N); cause != nil {
+		config.logger.Info("restart planned", "at", at.Format(time.RFC3339))
+		go watchLifetime(ctx, at, cause, trigger)
+	}
+
+	if config.leakSettle >= 0 && !callerLifecycle {
+		config.logger.Warn("leak report disabled, it needs a lifecycle set with WithLifecycle")
+	}
+	if config.leakSettle >= 0 && callerLifecycle {
+		// the baseline includes the goroutines started above, the report runs as the last step of the
+		// graceful path, once the caller reported it complete
+		report := newLeakReport(config.leakSettle, config.logger)
+		lc.Subscribe(func(_, to State) {
+			if to == StateStopped {
+				report.run()
+			}
+		})
+	}
+
 	return ctx, cancel
 }
 
+// TriggerShutdown starts the graceful shutdown the context comes from, as a signal would, recording
+// the given cause. It reports false if the context does not come from GracefulShutdown. Only the
+// first trigger starts the shutdown, later ones are ignored.
+func TriggerShutdown(ctx context.Context, cause error) bool {
+	c := controlFrom(ctx)
+	if c == nil {
+		return false
+	}
+	c.trigger(cause)
+	return true
+}
+
+// shutdownControlKey is the context key of the shutdownControl set by GracefulShutdown.
+type shutdownControlKey struct{}
+
+// shutdownControl gives components handed the shutdown context access to the shutdown.
+type shutdownControl struct {
+	trigger         func(error)
+	lifecycle       *Lifecycle
+	callerLifecycle bool // the lifecycle was set with WithLifecycle, so the caller can move it to Stopped
+	started         time.Time
+	servers         *serverRegistry // servers run with the context, reported by the control socket
+}
+
+// controlFrom returns the shutdownControl carried by the context, nil if it does not come from
+// GracefulShutdown.
+func controlFrom(ctx context.Context) *shutdownControl {
+	c, _ := ctx.Value(shutdownControlKey{}).(*shutdownControl)
+	return c
+}
+
+// SignalError is the shutdown cause recorded when a termination signal triggered the shutdown.
+type SignalError struct {
+	Signal os.Signal
+}
+
+// Error returns the description of the cause.
+func (e *SignalError) Error() string {
+	return "received signal " + e.Signal.String()
+}
+
 // ShutdownOption configures shutdown behavior
 type ShutdownOption func(*shutdownConfig)
 
@@ -69,7 +221,24 @@ type shutdownConfig struct {
 	onShutdown  func(os.Signal)
 	onForceExit func()
 	logger      *slog.Logger
-	osExit      func(int) // for testing to avoid actual os.Exit
+	lifecycle   *Lifecycle
+	drainDelay  time.Duration
+	leakSettle  time.Duration // negative disables the leak report
+
+	resourceChecks   []resourceCheck
+	resourceInterval time.Duration
+
+	parentWatch    bool
+	parentSignal   os.Signal
+	parentInterval time.Duration
+	getppid        func() int // for testing to fake a reparented process
+	stdin          io.Reader
+
+	maxLifetime            time.Duration
+	lifetimeJitter         time.Duration
+	restartWindow          bool
+	windowStart, windowEnd time.Duration
+	osExit                 func(int) // for testing to avoid actual os.Exit
 }
 
 // WithSignals sets which signals trigger the shutdown
@@ -121,6 +290,32 @@ func WithLogger(logger *slog.Logger) ShutdownOption {
 	}
 }
 
+// WithLifecycle sets the lifecycle driven by the shutdown, letting components follow its stages
+func WithLifecycle(lc *Lifecycle) ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.lifecycle = lc
+	}
+}
+
+// WithDrainDelay sets how long the process stays draining after the signal before the returned
+// context is canceled, e.g. to let a load balancer deregister the instance
+func WithDrainDelay(delay time.Duration) ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.drainDelay = delay
+	}
+}
+
+// WithLeakReport enables a report of the goroutines started after GracefulShutdown was called and
+// still running once the lifecycle set with WithLifecycle enters StateStopped. Leaked goroutines are
+// logged grouped by creation stack, those exiting within the settle period are not reported. The
+// report runs within the caller's Transition to StateStopped, blocking it for up to the settle period.
+// Without WithLifecycle there is no Stopped state to report at, the report is disabled with a warning
+func WithLeakReport(settle time.Duration) ShutdownOption {
+	return func(c *shutdownConfig) {
+		c.leakSettle = max(settle, 0)
+	}
+}
+
 // withOsExit is for testing only - allows overriding os.Exit
 func withOsExit(exit func(int)) ShutdownOption { //nolint:unused // false positive, used in tests
 	return func(c *shutdownConfig) {
@@ -234,6 +234,90 @@ func (s *ShutdownTestSuite) TestGracefulShutdown() {
 		s.Equal(1, code)
 	})
 
+	s.Run("lifecycle follows the shutdown", func() {
+		lc := NewLifecycle()
+		s.Require().NoError(lc.Transition(StateReady))
+
+		var mu sync.Mutex
+		var seen []State
+		lc.Subscribe(func(_, to State) {
+			mu.Lock()
+			defer mu.Unlock()
+			seen = append(seen, to)
+		})
+
+		drainDelay := 100 * time.Millisecond
+		shutdownCtx, cancel := GracefulShutdown(
+			WithSignals(syscall.SIGUSR1),
+			WithLifecycle(lc),
+			WithDrainDelay(drainDelay),
+			WithoutForceExit(),
+		)
+		defer cancel()
+
+		process, err := os.FindProcess(os.Getpid())
+		s.Require().NoError(err)
+		s.Require().NoError(process.Signal(syscall.SIGUSR1))
+
+		// the drain begins on the signal, while the components keep running for the drain delay
+		select {
+		case <-lc.Context(StateDraining).Done():
+		case <-time.After(waitLimit):
+			s.Fail("lifecycle did not start draining")
+			return
+		}
+		drainStarted := time.Now()
+		s.NoError(shutdownCtx.Err(), "the context outlives the drain delay")
+
+		select {
+		case <-shutdownCtx.Done():
+		case <-time.After(waitLimit):
+			s.Fail("context was not canceled after the drain delay")
+			return
+		}
+		s.GreaterOrEqual(time.Since(drainStarted), drainDelay/2)
+		s.Equal(StateStopping, lc.State())
+
+		s.Require().NoError(lc.Transition(StateStopped))
+		cancel() // a late cancel leaves the completed lifecycle alone
+		s.Equal(StateStopped, lc.State())
+
+		mu.Lock()
+		defer mu.Unlock()
+		s.Equal([]State{StateDraining, StateStopping, StateStopped}, seen)
+	})
+
+	s.Run("lifecycle force exiting", func() {
+		lc := NewLifecycle()
+		exitCalls := make(chan int, 1)
+
+		_, cancel := GracefulShutdown(
+			WithSignals(syscall.SIGUSR2),
+			WithLifecycle(lc),
+			WithTimeout(50*time.Millisecond),
+			WithDrainDelay(time.Hour), // the timeout expires while still draining
+			withOsExit(func(code int) { exitCalls <- code }),
+		)
+		defer cancel()
+
+		process, err := os.FindProcess(os.Getpid())
+		s.Require().NoError(err)
+		s.Require().NoError(process.Signal(syscall.SIGUSR2))
+
+		s.Equal(1, s.awaitExit(exitCalls))
+		s.Equal(StateForceExiting, lc.State())
+	})
+
+	s.Run("manual cancel stops the lifecycle", func() {
+		lc := NewLifecycle()
+		shutdownCtx, cancel := GracefulShutdown(WithLifecycle(lc), WithoutForceExit())
+
+		cancel()
+		s.Equal(context.Canceled, shutdownCtx.Err())
+		s.Equal(StateStopping, lc.State())
+		s.Error(lc.Context(StateDraining).Err())
+	})
+
 	s.Run("timeout accuracy", func() {
 		timeout := 200 * time.Millisecond
 		// the shutdown callback runs when the signal arrives, which is when the timer starts
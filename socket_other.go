@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd)
+
+package ctrl
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+)
+
+// listenSocket listens on the unix socket path and sets the mode of the socket file, zero to keep it.
+func listenSocket(path string, mode fs.FileMode) (net.Listener, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil || mode == 0 {
+		return listener, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("set socket mode: %w", err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd
+
+package ctrl
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes the umask changes of the listeners, the umask is process-wide.
+var umaskMu sync.Mutex //nolint:gochecknoglobals // guards the process-wide umask
+
+// listenSocket listens on the unix socket path and sets the mode of the socket file, zero for the mode
+// the umask gives. The file is created accessible to the owner only, so no one else can connect before
+// the mode is set.
+func listenSocket(path string, mode fs.FileMode) (net.Listener, error) {
+	umaskMu.Lock()
+	umask := syscall.Umask(0o177)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	umaskMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == 0 {
+		mode = 0o777 &^ fs.FileMode(umask) //nolint:gosec // the umask is a 9 bits mode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("set socket mode: %w", err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd
+
+package ctrl
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenSocket(t *testing.T) {
+	// a container default, the socket would be open to everyone until narrowed
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+	dir := filepath.Dir(socketPath(t))
+
+	l, err := listenSocket(filepath.Join(dir, "narrow.sock"), 0o600)
+	require.NoError(t, err)
+	defer l.Close()
+	fi, err := os.Stat(filepath.Join(dir, "narrow.sock"))
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), fi.Mode().Perm())
+
+	l, err = listenSocket(filepath.Join(dir, "default.sock"), 0)
+	require.NoError(t, err)
+	defer l.Close()
+	fi, err = os.Stat(filepath.Join(dir, "default.sock"))
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o777), fi.Mode().Perm(), "the mode the umask gives by default")
+
+	assert.Equal(t, 0, syscall.Umask(0), "the umask is restored")
+}
@@ -0,0 +1,327 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrRestartIntensity is the shutdown cause recorded when the workers of a Supervisor restarted more
+// often than allowed with WithSupervisorIntensity. The cause wraps it with the details.
+var ErrRestartIntensity = errors.New("restart intensity exceeded")
+
+// Restart tells when a supervised worker is restarted.
+type Restart int
+
+// Restart modes of a worker.
+const (
+	RestartOnFailure Restart = iota // restarted once it returned an error, the default
+	RestartNever                    // never restarted
+	RestartAlways                   // restarted whenever it returned, even without an error
+)
+
+// SupervisorStrategy tells which workers are restarted when one of them is.
+type SupervisorStrategy int
+
+// Strategies of a supervisor.
+const (
+	OneForOne SupervisorStrategy = iota // only the worker that returned is restarted, the default
+	OneForAll                           // all running workers are stopped and restarted along with it
+)
+
+// WorkerError is an error of a worker run by a Supervisor.
+type WorkerError struct {
+	Name string // the name of the worker
+	Err  error
+}
+
+// Error returns the error prefixed by the worker name.
+func (e *WorkerError) Error() string {
+	return fmt.Sprintf("worker %s: %v", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *WorkerError) Unwrap() error {
+	return e.Err
+}
+
+// SupervisorOption represents a functional option for NewSupervisor.
+type SupervisorOption func(*supervisorOptions)
+
+type supervisorOptions struct {
+	strategy    SupervisorStrategy
+	policy      RestartPolicy
+	maxRestarts int
+	period      time.Duration
+	logger      *slog.Logger
+}
+
+// WithSupervisorStrategy sets which workers are restarted when one of them is, OneForOne by default.
+func WithSupervisorStrategy(strategy SupervisorStrategy) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.strategy = strategy
+	}
+}
+
+// WithSupervisorRestartPolicy sets the backoff between restarts and how many restarts in a row a worker
+// gets before it is given up. Unlike for servers, a nil Retryable restarts on any error.
+func WithSupervisorRestartPolicy(policy RestartPolicy) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.policy = policy
+	}
+}
+
+// WithSupervisorIntensity sets the maximum number of restarts, of all workers together, allowed within
+// the period. Going over it escalates to the graceful shutdown of the process, with ErrRestartIntensity
+// as the cause, or stops the supervisor if its context does not come from GracefulShutdown.
+func WithSupervisorIntensity(maxRestarts int, period time.Duration) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.maxRestarts = maxRestarts
+		o.period = period
+	}
+}
+
+// WithSupervisorLogger sets a custom logger for the supervisor.
+func WithSupervisorLogger(logger *slog.Logger) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.logger = logger
+	}
+}
+
+// WorkerOption represents a functional option for Supervisor.Go.
+type WorkerOption func(*worker)
+
+// WithWorkerRestart sets when the worker is restarted, RestartOnFailure by default.
+func WithWorkerRestart(restart Restart) WorkerOption {
+	return func(w *worker) {
+		w.restart = restart
+	}
+}
+
+// Supervisor runs named long-running workers, restarting them as they fail, until its context ends.
+type Supervisor struct {
+	parent  context.Context
+	ctx     context.Context
+	cancel  context.CancelFunc
+	options supervisorOptions
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	gen      *generation // the workers started together, replaced by a OneForAll restart
+	restarts []time.Time // the recent restarts, for the intensity
+	errs     []error
+}
+
+// worker is a function run by the supervisor.
+type worker struct {
+	name    string
+	fn      func(ctx context.Context) error
+	restart Restart
+}
+
+// generation is the set of worker runs stopped together by a OneForAll restart.
+type generation struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func newGeneration(ctx context.Context) *generation {
+	g := &generation{}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	return g
+}
+
+// NewSupervisor returns a supervisor running its workers with a context derived from the given one,
+// typically from GracefulShutdown: the workers are stopped once it is canceled.
+func NewSupervisor(ctx context.Context, opts ...SupervisorOption) *Supervisor {
+	options := supervisorOptions{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	s := &Supervisor{parent: ctx, options: options}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.gen = newGeneration(s.ctx)
+	return s
+}
+
+// Go starts the worker under the given name. The function is expected to run until its context is
+// canceled; when it returns it is restarted as set with WithWorkerRestart, after the backoff of the
+// restart policy. All workers are to be started before Wait is called.
+func (s *Supervisor) Go(name string, fn func(ctx context.Context) error, opts ...WorkerOption) {
+	w := &worker{name: name, fn: fn}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	s.wg.Add(1)
+	s.mu.Lock()
+	gen := s.gen
+	gen.running.Add(1)
+	s.mu.Unlock()
+	go s.run(w, gen)
+}
+
+// Wait waits for all workers to be done, either stopped with the context or given up, and returns the
+// errors they were given up with, joined, each a *WorkerError naming the worker. Errors of workers
+// that were restarted are logged only.
+func (s *Supervisor) Wait() error {
+	s.wg.Wait()
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.errs...)
+}
+
+// run runs the worker, restarting it as its mode and the strategy say, until it is done.
+func (s *Supervisor) run(w *worker, gen *generation) {
+	defer s.wg.Done()
+	restarts := 0
+	for {
+		started := time.Now()
+		err := w.fn(gen.ctx)
+		gen.running.Done()
+
+		if s.ctx.Err() != nil {
+			// the supervisor is stopping, the cancellation is the expected way out
+			if err != nil && !errors.Is(err, context.Canceled) {
+				s.fail(w.name, err)
+			}
+			return
+		}
+		if gen.ctx.Err() != nil {
+			// stopped by the OneForAll restart of another worker, started again along with it
+			if w.restart == RestartNever {
+				return
+			}
+			gen = s.rejoin(gen)
+			continue
+		}
+
+		if !s.shouldRestart(w, err) {
+			if err != nil {
+				s.fail(w.name, err)
+			}
+			s.options.logger.Info("worker done", "worker", w.name, "error", err)
+			return
+		}
+		if s.options.policy.ResetAfter > 0 && time.Since(started) >= s.options.policy.ResetAfter {
+			restarts = 0
+		}
+		if s.options.policy.exhausted(restarts) {
+			s.options.logger.Error("worker failed, giving up", "worker", w.name, "restarts", restarts, "error", err)
+			// a RestartAlways worker may well have returned without an error
+			giveUp := fmt.Errorf("gave up after %d restarts, returned without error", restarts)
+			if err != nil {
+				giveUp = fmt.Errorf("gave up after %d restarts: %w", restarts, err)
+			}
+			s.fail(w.name, giveUp)
+			return
+		}
+		if s.intensityExceeded() {
+			s.escalate(w.name, err)
+			return
+		}
+
+		restarts++
+		wait := s.options.policy.backoff(restarts, randInt64N)
+		s.options.logger.Warn("worker stopped, restarting", "worker", w.name, "attempt", restarts, "backoff", wait, "error", err)
+		if s.options.strategy == OneForAll {
+			s.stopGeneration(gen)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+		gen = s.rejoin(gen)
+	}
+}
+
+// shouldRestart reports whether the worker is restarted after returning the error.
+func (s *Supervisor) shouldRestart(w *worker, err error) bool {
+	if err != nil && s.options.policy.Retryable != nil && !s.options.policy.Retryable(err) {
+		return false
+	}
+	switch w.restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// stopGeneration stops the runs of the generation and starts a new one, unless another worker did it.
+func (s *Supervisor) stopGeneration(gen *generation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen != gen {
+		return
+	}
+	gen.cancel()
+	s.gen = newGeneration(s.ctx)
+}
+
+// rejoin returns the generation to start a run in, once the runs of the previous one, if replaced,
+// all returned.
+func (s *Supervisor) rejoin(prev *generation) *generation {
+	s.mu.Lock()
+	replaced := s.gen != prev
+	s.mu.Unlock()
+	if replaced {
+		prev.running.Wait()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen.running.Add(1)
+	return s.gen
+}
+
+// intensityExceeded records a restart and reports whether there were too many within the period.
+func (s *Supervisor) intensityExceeded() bool {
+	if s.options.maxRestarts <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.options.period {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = append(recent, now)
+	return len(s.restarts) > s.options.maxRestarts
+}
+
+// escalate gives the worker up and shuts the process down, or the supervisor without GracefulShutdown.
+func (s *Supervisor) escalate(name string, err error) {
+	cause := fmt.Errorf("%w: more than %d restarts in %s, last by worker %s", ErrRestartIntensity,
+		s.options.maxRestarts, s.options.period, name)
+	s.options.logger.Error("restart intensity exceeded, shutting down", "worker", name, "error", err)
+	failure := fmt.Errorf("%w, returned without error", ErrRestartIntensity)
+	if err != nil {
+		failure = fmt.Errorf("%w: %w", ErrRestartIntensity, err)
+	}
+	s.fail(name, failure)
+	if !TriggerShutdown(s.parent, cause) {
+		s.cancel()
+	}
+}
+
+// fail records the error the worker was given up with.
+func (s *Supervisor) fail(name string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, &WorkerError{Name: name, Err: err})
+}
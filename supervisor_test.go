@@ -0,0 +1,180 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor(t *testing.T) {
+	logger := WithSupervisorLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	fast := WithSupervisorRestartPolicy(RestartPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	errBoom := errors.New("boom")
+
+	t.Run("failed worker restarted until the context ends", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		s := NewSupervisor(ctx, logger, fast)
+		var runs atomic.Int32
+		s.Go("flaky", func(ctx context.Context) error {
+			if runs.Add(1) < 3 {
+				return errBoom
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.Eventually(t, func() bool { return runs.Load() == 3 }, time.Second, time.Millisecond)
+		cancel()
+		require.NoError(t, s.Wait())
+	})
+
+	t.Run("restart modes", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s := NewSupervisor(ctx, logger, fast)
+		s.Go("never", func(context.Context) error { return errBoom }, WithWorkerRestart(RestartNever))
+		s.Go("done", func(context.Context) error { return nil })
+		var runs atomic.Int32
+		s.Go("always", func(ctx context.Context) error {
+			if runs.Add(1) < 3 {
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}, WithWorkerRestart(RestartAlways))
+		require.Eventually(t, func() bool { return runs.Load() == 3 }, time.Second, time.Millisecond)
+		cancel()
+
+		err := s.Wait()
+		require.ErrorIs(t, err, errBoom)
+		var werr *WorkerError
+		require.ErrorAs(t, err, &werr)
+		assert.Equal(t, "never", werr.Name)
+		assert.Equal(t, "worker never: boom", err.Error())
+	})
+
+	t.Run("worker given up after the attempts", func(t *testing.T) {
+		s := NewSupervisor(context.Background(), logger, WithSupervisorRestartPolicy(
+			RestartPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+		var runs atomic.Int32
+		s.Go("broken", func(context.Context) error { runs.Add(1); return errBoom })
+		err := s.Wait()
+		require.ErrorIs(t, err, errBoom)
+		assert.Contains(t, err.Error(), "worker broken: gave up after 2 restarts")
+		assert.Equal(t, int32(3), runs.Load())
+	})
+
+	t.Run("restarted always until given up", func(t *testing.T) {
+		s := NewSupervisor(context.Background(), logger, WithSupervisorRestartPolicy(
+			RestartPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+		s.Go("tick", func(context.Context) error { return nil }, WithWorkerRestart(RestartAlways))
+		err := s.Wait()
+		require.Error(t, err)
+		assert.Equal(t, "worker tick: gave up after 2 restarts, returned without error", err.Error())
+
+		s = NewSupervisor(context.Background(), logger, fast, WithSupervisorIntensity(2, time.Minute))
+		s.Go("tick", func(context.Context) error { return nil }, WithWorkerRestart(RestartAlways))
+		err = s.Wait()
+		require.ErrorIs(t, err, ErrRestartIntensity)
+		assert.Equal(t, "worker tick: restart intensity exceeded, returned without error", err.Error())
+	})
+
+	t.Run("non-retryable failure not restarted", func(t *testing.T) {
+		s := NewSupervisor(context.Background(), logger, WithSupervisorRestartPolicy(RestartPolicy{
+			InitialBackoff: time.Millisecond, Retryable: func(err error) bool { return !errors.Is(err, errBoom) }}))
+		var runs atomic.Int32
+		s.Go("fatal", func(context.Context) error { runs.Add(1); return errBoom })
+		require.ErrorIs(t, s.Wait(), errBoom)
+		assert.Equal(t, int32(1), runs.Load())
+	})
+
+	t.Run("one for all restarts the other workers", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		s := NewSupervisor(ctx, logger, fast, WithSupervisorStrategy(OneForAll))
+		var failing, steady, temporary atomic.Int32
+		s.Go("failing", func(ctx context.Context) error {
+			if failing.Add(1) == 1 {
+				return errBoom
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		s.Go("steady", func(ctx context.Context) error {
+			steady.Add(1)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		s.Go("temporary", func(ctx context.Context) error {
+			temporary.Add(1)
+			<-ctx.Done()
+			return ctx.Err()
+		}, WithWorkerRestart(RestartNever))
+		require.Eventually(t, func() bool { return failing.Load() == 2 && steady.Load() == 2 }, time.Second, time.Millisecond)
+		cancel()
+		require.NoError(t, s.Wait())
+		assert.Equal(t, int32(1), temporary.Load(), "a worker never restarted is not started again")
+	})
+
+	t.Run("one for one leaves the other workers running", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		s := NewSupervisor(ctx, logger, fast)
+		var failing, steady atomic.Int32
+		s.Go("failing", func(ctx context.Context) error {
+			if failing.Add(1) == 1 {
+				return errBoom
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		s.Go("steady", func(ctx context.Context) error {
+			steady.Add(1)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.Eventually(t, func() bool { return failing.Load() == 2 }, time.Second, time.Millisecond)
+		cancel()
+		require.NoError(t, s.Wait())
+		assert.Equal(t, int32(1), steady.Load())
+	})
+
+	t.Run("intensity exceeded stops the supervisor", func(t *testing.T) {
+		s := NewSupervisor(context.Background(), logger, fast, WithSupervisorIntensity(3, time.Minute))
+		s.Go("crashing", func(context.Context) error { return errBoom })
+		s.Go("steady", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		err := s.Wait()
+		require.ErrorIs(t, err, ErrRestartIntensity)
+		require.ErrorIs(t, err, errBoom)
+		assert.Contains(t, err.Error(), "worker crashing")
+	})
+
+	t.Run("intensity exceeded escalates to graceful shutdown", func(t *testing.T) {
+		lc := NewLifecycle()
+		ctx, cancel := GracefulShutdown(WithLifecycle(lc), WithoutForceExit(),
+			WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+		defer cancel()
+		s := NewSupervisor(ctx, logger, fast, WithSupervisorIntensity(2, time.Minute))
+		s.Go("crashing", func(context.Context) error { return errBoom })
+		s.Go("steady", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("shutdown not triggered")
+		}
+		require.ErrorIs(t, context.Cause(ctx), ErrRestartIntensity)
+		assert.Contains(t, context.Cause(ctx).Error(), "last by worker crashing")
+		require.ErrorIs(t, s.Wait(), ErrRestartIntensity)
+	})
+}
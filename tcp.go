@@ -0,0 +1,206 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// TCPOption represents a functional option for RunTCPServerWithContext.
+type TCPOption func(*tcpOptions)
+
+type tcpOptions struct {
+	shutdownTimeout time.Duration
+	logger          *slog.Logger
+}
+
+// WithTCPShutdownTimeout sets the maximum time to wait for the connections to be done.
+func WithTCPShutdownTimeout(timeout time.Duration) TCPOption {
+	return func(o *tcpOptions) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithTCPLogger sets a custom logger for the TCP server.
+func WithTCPLogger(logger *slog.Logger) TCPOption {
+	return func(o *tcpOptions) {
+		o.logger = logger
+	}
+}
+
+// RunTCPServerWithContext accepts connections on the listener and serves each with the handler in a
+// goroutine of its own, the connection closed once the handler returns. When the provided context is
+// canceled the listener is closed, the context of every handler is canceled to tell it to finish,
+// and the connections are awaited up to the shutdown timeout, then the remaining ones closed. With a
+// context from GracefulShutdown the handler contexts are canceled as soon as the process enters
+// StateDraining.
+//
+// It mirrors the error channel of RunHTTPServerWithContext: the result is published once the server
+// stopped, a shutdown timeout is reported as an error wrapping context.DeadlineExceeded along with the
+// number of connections closed, and a listener failing on its own is reported right away, the
+// handlers told to finish.
+func RunTCPServerWithContext(ctx context.Context, listener net.Listener, handler func(ctx context.Context, conn net.Conn),
+	opts ...TCPOption) <-chan error {
+	options := tcpOptions{
+		shutdownTimeout: 10 * time.Second, // default timeout
+		logger:          slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// handlers are told to finish once the server drains, they keep the values of the caller's context
+	connCtx, cancelConns := context.WithCancel(context.WithoutCancel(ctx))
+	s := &tcpServer{listener: listener, handler: handler, logger: options.logger,
+		connCtx: connCtx, cancelConns: cancelConns, conns: map[net.Conn]struct{}{}, changed: make(chan struct{})}
+
+	drain := newDrainSignal()
+	go drain.watch(connCtx)
+	go func() {
+		select {
+		case <-drain.ch:
+			cancelConns()
+		case <-connCtx.Done():
+		}
+	}()
+
+	return RunService(ctx, s,
+		WithServiceShutdownTimeout(options.shutdownTimeout),
+		WithServiceLogger(options.logger),
+		WithServiceName(listener.Addr().String()),
+		withServiceKind("tcp"),
+	)
+}
+
+// tcpServer is the Service behind RunTCPServerWithContext.
+type tcpServer struct {
+	listener    net.Listener
+	handler     func(ctx context.Context, conn net.Conn)
+	logger      *slog.Logger
+	connCtx     context.Context
+	cancelConns context.CancelFunc
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	changed  chan struct{} // closed and replaced each time a connection is done
+	stopping bool
+}
+
+// Run accepts connections until the listener is closed. Temporary accept failures, such as running out
+// of file descriptors, are retried with a backoff. The handlers are told to finish once it returned,
+// whether on shutdown or after a failure.
+func (s *tcpServer) Run(ctx context.Context) error {
+	defer s.cancelConns()
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.stop()
+		case <-stopped:
+		}
+	}()
+
+	var tempDelay time.Duration // how long to sleep on a temporary accept failure, as net/http does
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			stopping := s.stopping
+			s.mu.Unlock()
+			if stopping {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() { //nolint:staticcheck // the only way to tell EMFILE and alike
+				tempDelay = min(max(tempDelay*2, 5*time.Millisecond), time.Second)
+				s.logger.Warn("accept error, retrying", "delay", tempDelay, "error", err)
+				timer := time.NewTimer(tempDelay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+				}
+				continue
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+		tempDelay = 0
+		s.track(conn)
+		go s.serve(conn)
+	}
+}
+
+// Shutdown stops accepting, tells the handlers to finish and waits for them until the context ends,
+// then closes the connections still open.
+func (s *tcpServer) Shutdown(ctx context.Context) error {
+	s.stop()
+	s.cancelConns()
+	for {
+		s.mu.Lock()
+		open, changed := len(s.conns), s.changed
+		s.mu.Unlock()
+		if open == 0 {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			closed := s.closeAll()
+			s.logger.Warn("forcibly closed TCP connections", "connections", closed)
+			return fmt.Errorf("forcibly closed %d connections: %w", closed, ctx.Err())
+		}
+	}
+}
+
+// stop closes the listener, repeated calls do nothing.
+func (s *tcpServer) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return
+	}
+	s.stopping = true
+	if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.logger.Warn("can't close TCP listener", "error", err)
+	}
+}
+
+// serve runs the handler and closes the connection once it returned.
+func (s *tcpServer) serve(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+	s.handler(s.connCtx, conn)
+}
+
+// track adds an open connection.
+func (s *tcpServer) track(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = struct{}{}
+}
+
+// untrack forgets a connection whose handler returned.
+func (s *tcpServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// closeAll closes the connections still open and returns how many there were.
+func (s *tcpServer) closeAll() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	return len(s.conns)
+}
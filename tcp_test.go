@@ -0,0 +1,146 @@
+package ctrl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTCPServerWithContext(t *testing.T) {
+	logger := WithTCPLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// echo answers lines until told to finish, then says goodbye
+	echo := func(ctx context.Context, conn net.Conn) {
+		lines := make(chan string)
+		go func() {
+			defer close(lines)
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+		}()
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					return
+				}
+				_, _ = fmt.Fprintf(conn, "echo %s\n", line)
+			case <-ctx.Done():
+				_, _ = fmt.Fprint(conn, "bye\n")
+				return
+			}
+		}
+	}
+
+	t.Run("handlers drained on shutdown", func(t *testing.T) {
+		l, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunTCPServerWithContext(ctx, l, echo, logger)
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		_, err = fmt.Fprint(conn, "hello\n")
+		require.NoError(t, err)
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "echo hello\n", line)
+
+		cancel()
+		require.NoError(t, <-errCh)
+		line, err = r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "bye\n", line)
+		_, err = r.ReadString('\n')
+		require.ErrorIs(t, err, io.EOF, "the connection is closed once the handler returned")
+		_, err = net.Dial("tcp", l.Addr().String())
+		require.Error(t, err, "no longer accepting")
+	})
+
+	t.Run("stuck handlers closed after the timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		accepted := make(chan struct{})
+		l, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunTCPServerWithContext(ctx, l, func(context.Context, net.Conn) {
+			close(accepted)
+			<-release
+		}, logger, WithTCPShutdownTimeout(50*time.Millisecond))
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		<-accepted
+
+		cancel()
+		err = <-errCh
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "forcibly closed 1 connections")
+		_ = conn.SetReadDeadline(time.Now().Add(waitLimit))
+		_, err = conn.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("temporary accept errors retried", func(t *testing.T) {
+		l, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		flaky := &flakyListener{Listener: l, failures: 3}
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := RunTCPServerWithContext(ctx, flaky, echo, logger)
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SetDeadline(time.Now().Add(waitLimit)))
+		_, err = fmt.Fprint(conn, "hi\n")
+		require.NoError(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "echo hi\n", line, "served after the temporary failures")
+
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("listener failing on its own", func(t *testing.T) {
+		l, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+		require.NoError(t, l.Close())
+		err = <-RunTCPServerWithContext(context.Background(), l, echo, logger)
+		require.Error(t, err)
+		require.ErrorIs(t, err, net.ErrClosed)
+	})
+}
+
+// flakyListener fails the first accepts with a temporary error, as on running out of file descriptors
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, temporaryError{}
+	}
+	return l.Listener.Accept()
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }